@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"searchengine/internal/eval"
+	"text/tabwriter"
+	"time"
+)
+
+// коды выхода подкоманды eval
+const (
+	evalOK         = 0
+	evalRegression = 1
+	evalError      = 2
+)
+
+// runEval - подкоманда eval: оценивает конфиг-кандидат ранжирования по списку оценок на запущенном сервисе.
+// Возвращает evalRegression, если NDCG@k кандидата хуже текущего больше чем на max-drop, - для проверки в CI.
+//
+//	go run ./cmd eval -list shoes -config rank_candidate.json -k 10 -max-drop 0.01
+func runEval(args []string) int {
+	fs := flag.NewFlagSet("eval", flag.ContinueOnError)
+	addr := fs.String("addr", "http://localhost:8080", "адрес публичного API сервиса")
+	list := fs.String("list", "", "id списка оценок (POST /api/v1/eval/judgments)")
+	cfgPath := fs.String("config", "", "файл конфига-кандидата ранжирования, без него оценивается текущий конфиг")
+	k := fs.Int("k", 10, "глубина оценки выдачи")
+	maxDrop := fs.Float64("max-drop", 0, "допустимое падение NDCG@k кандидата относительно текущего конфига")
+	asJSON := fs.Bool("json", false, "вывести отчет в JSON")
+	timeout := fs.Duration("timeout", time.Minute, "таймаут запроса к сервису")
+	if err := fs.Parse(args); err != nil {
+		return evalError
+	}
+	if *list == "" {
+		fmt.Fprintln(os.Stderr, "eval: -list is required")
+		fs.Usage()
+		return evalError
+	}
+
+	req := map[string]interface{}{"list": *list, "k": *k}
+	if *cfgPath != "" {
+		data, err := os.ReadFile(*cfgPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "eval:", err)
+			return evalError
+		}
+		req["rankConfig"] = json.RawMessage(data)
+	}
+
+	report, raw, err := requestEval(*addr, req, *timeout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "eval:", err)
+		return evalError
+	}
+
+	if *asJSON {
+		os.Stdout.Write(raw)
+		fmt.Println()
+	} else {
+		printReport(report)
+	}
+
+	if report.Delta != nil && report.Delta.NDCG < -*maxDrop {
+		fmt.Fprintf(os.Stderr, "eval: NDCG@%d dropped by %.4f (max-drop %.4f)\n", report.K, -report.Delta.NDCG, *maxDrop)
+		return evalRegression
+	}
+	return evalOK
+}
+
+// requestEval отправляет запрос оценки в POST /api/v1/eval/run
+func requestEval(addr string, req map[string]interface{}, timeout time.Duration) (*eval.Report, []byte, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Post(addr+"/api/v1/eval/run", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("%s: %s", resp.Status, raw)
+	}
+
+	report := new(eval.Report)
+	if err = json.Unmarshal(raw, report); err != nil {
+		return nil, nil, err
+	}
+	return report, raw, nil
+}
+
+// printReport печатает средние метрики и метрики по запросам
+func printReport(r *eval.Report) {
+	fmt.Printf("list: %s, k: %d, queries: %d\n\n", r.List, r.K, len(r.Queries))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if r.Candidate == nil {
+		fmt.Fprintln(w, "metric\tcurrent")
+		fmt.Fprintf(w, "NDCG@%d\t%.4f\n", r.K, r.Current.NDCG)
+		fmt.Fprintf(w, "MRR\t%.4f\n", r.Current.MRR)
+		fmt.Fprintf(w, "P@%d\t%.4f\n", r.K, r.Current.Precision)
+		w.Flush()
+
+		fmt.Println()
+		fmt.Fprintln(w, "query\tNDCG\tMRR\tP\tunjudged")
+		for _, q := range r.Queries {
+			fmt.Fprintf(w, "%s\t%.4f\t%.4f\t%.4f\t%d\n", q.Query, q.Current.NDCG, q.Current.MRR, q.Current.Precision, q.Current.Unjudged)
+		}
+		w.Flush()
+		return
+	}
+
+	fmt.Fprintln(w, "metric\tcurrent\tcandidate\tdelta")
+	fmt.Fprintf(w, "NDCG@%d\t%.4f\t%.4f\t%+.4f\n", r.K, r.Current.NDCG, r.Candidate.NDCG, r.Delta.NDCG)
+	fmt.Fprintf(w, "MRR\t%.4f\t%.4f\t%+.4f\n", r.Current.MRR, r.Candidate.MRR, r.Delta.MRR)
+	fmt.Fprintf(w, "P@%d\t%.4f\t%.4f\t%+.4f\n", r.K, r.Current.Precision, r.Candidate.Precision, r.Delta.Precision)
+	w.Flush()
+
+	fmt.Println()
+	fmt.Fprintln(w, "query\tNDCG current\tNDCG candidate\tdelta\tunjudged")
+	for _, q := range r.Queries {
+		fmt.Fprintf(w, "%s\t%.4f\t%.4f\t%+.4f\t%d\n", q.Query, q.Current.NDCG, q.Candidate.NDCG, q.Delta.NDCG, q.Candidate.Unjudged)
+	}
+	w.Flush()
+}
@@ -8,13 +8,18 @@ import (
 	"os"
 	"os/signal"
 	"searchengine/internal/config"
+	"searchengine/internal/eval"
+	"searchengine/internal/experiment"
 	"searchengine/internal/filter"
 	"searchengine/internal/index"
 	"searchengine/internal/metrics"
 	"searchengine/internal/rank"
+	"searchengine/internal/rules"
 	"searchengine/internal/search"
 	"searchengine/internal/server"
+	"searchengine/internal/spell"
 	"searchengine/internal/subscriber"
+	"searchengine/internal/synonym"
 	"syscall"
 	"time"
 )
@@ -31,6 +36,11 @@ func initLogger() {
 }
 
 func main() {
+	// подкоманда eval - клиент оценки ранжирования, сервис не запускается
+	if len(os.Args) > 1 && os.Args[1] == "eval" {
+		os.Exit(runEval(os.Args[2:]))
+	}
+
 	initLogger()
 	go metrics.RecordSysMetrics()
 
@@ -54,12 +64,57 @@ func main() {
 
 	// ====== Ranking ======
 	log.Println("[SERVICE] INITIALIZING RANKING CLIENT")
-	rankCli := rank.New(cfg.RankCfg)
+	rankCli, err := rank.New(cfg)
+	if err != nil {
+		log.Fatalln("[RANK][ERROR] invalid rank config:", err)
+	}
+	// ====================
+
+	// ====== Spell ======
+	log.Println("[SERVICE] INITIALIZING SPELL CLIENT")
+	spellCli := spell.New(cfg, indexCLi)
+	// ====================
+
+	// ====== Rules ======
+	log.Println("[SERVICE] INITIALIZING RULES CLIENT")
+	rulesCli, err := rules.New(cfg)
+	if err != nil {
+		log.Fatalln("[RULES][ERROR] error while loading merchandising rules:", err)
+	}
+	// ====================
+
+	// ====== Query rewriting ======
+	log.Println("[SERVICE] INITIALIZING QUERY REWRITER")
+	rewriter, err := search.NewRewriter(cfg.RewriteCfg, filterCli)
+	if err != nil {
+		log.Fatalln("[REWRITE][ERROR] invalid rewrite config:", err)
+	}
 	// ====================
 
 	// ====== Search Client ======
 	log.Println("[SERVICE] INITIALIZING SEARCH CLIENT")
-	searchCli := search.NewSearchClient(indexCLi, rankCli, filterCli)
+	searchCli := search.NewSearchClient(indexCLi, rankCli, filterCli, spellCli, rulesCli, rewriter)
+	// ====================
+
+	// ====== Synonyms ======
+	log.Println("[SERVICE] INITIALIZING SYNONYM CLIENT")
+	synonymCli := synonym.New(cfg, indexCLi)
+	// ====================
+
+	// ====== Evaluation ======
+	log.Println("[SERVICE] INITIALIZING EVALUATION CLIENT")
+	evalCli, err := eval.New(cfg, searchCli)
+	if err != nil {
+		log.Fatalln("[EVAL][ERROR] error while loading judgment lists:", err)
+	}
+	// ====================
+
+	// ====== Experiments ======
+	log.Println("[SERVICE] INITIALIZING EXPERIMENT CLIENT")
+	experimentCli, err := experiment.New(cfg)
+	if err != nil {
+		log.Fatalln("[EXPERIMENT][ERROR] invalid experiment config:", err)
+	}
 	// ====================
 
 	// ====== Subscriber ======
@@ -70,7 +125,7 @@ func main() {
 
 	// ====== Server ======
 	log.Println("[SERVICE] START SERVER")
-	srv := server.New(cfg, indexCLi, searchCli, filterCli)
+	srv := server.New(cfg, indexCLi, searchCli, filterCli, synonymCli, rulesCli, evalCli, experimentCli)
 	log.Println("[SERVER] Start")
 	srv.Start()
 	// ====================
@@ -78,7 +133,7 @@ func main() {
 	<-stop
 	ctxClose, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
-	err := srv.Stop(ctxClose)
+	err = srv.Stop(ctxClose)
 	if err != nil {
 		log.Fatalln("[SERVER][ERROR] error while stopping: ", err)
 	}
@@ -1,6 +1,9 @@
 package request
 
-import "searchengine/internal/config"
+import (
+	"encoding/json"
+	"searchengine/internal/config"
+)
 
 // filters request
 type OneSelectFilterReq struct {
@@ -19,4 +22,94 @@ type FilterRequest struct {
 	MultiSelect []config.MultiSelectFilter `json:"multi-select"`
 	OneSelect   []OneSelectFilterReq       `json:"one-select"`
 	BoolSelect  []BoolSelectFilterReq      `json:"bool-select"`
+
+	// Price - цена, найденная в тексте запроса (intent): отдельное условие И, а не еще один диапазон из Range
+	Price *config.RangeFilter `json:"-"`
+}
+
+// SearchRequest - параметры поискового запроса
+type SearchRequest struct {
+	Query     string
+	Filters   *FilterRequest
+	SortField string
+	SortOrder string
+
+	// пагинация: From/Size или курсор (search_after)
+	From   int
+	Size   int
+	Cursor string
+
+	// Facets - посчитать количество документов по значениям фильтров категории
+	Facets bool
+
+	// Highlight - подсветка совпадений в найденных документах, nil - без подсветки
+	Highlight *HighlightRequest
+
+	// Fields - поля документа в ответе, пусто - все поля
+	Fields []string
+	// ExcludeFields - поля, которые не нужно отдавать в ответе (например, длинный текст статьи)
+	ExcludeFields []string
+
+	// SearchFields - поля полнотекстового поиска с весами, пусто - все searchable поля с весами профиля ранжирования
+	SearchFields []FieldWeight
+	// Operator - and: в документе должны быть все слова запроса, or (по умолчанию) - хотя бы одно
+	Operator string
+	// MinimumShouldMatch - сколько слов запроса должно совпасть при or: число ("2", "-1") или процент ("75%", "-25%")
+	MinimumShouldMatch string
+
+	// AutoCorrect - если запрос ничего не нашел, искать по исправленному запросу
+	AutoCorrect bool
+	// Intent - найти в словах запроса значения фильтров и цену и искать по ним как по фильтрам
+	Intent bool
+	// Fuzziness - допустимое число правок в словах запроса (0-2), nil - по умолчанию
+	Fuzziness *int
+
+	// RankProfile - профиль ранжирования, пусто - профиль категории из Filters или профиль по умолчанию
+	RankProfile string
+
+	// Explain - добавить к документам объяснение score: дерево bleve и вклад профиля ранжирования
+	Explain bool
+}
+
+// FieldWeight - поле полнотекстового поиска и вес совпадения в нем
+type FieldWeight struct {
+	Field  string  `json:"field"`
+	Weight float64 `json:"weight"`
+}
+
+// HighlightRequest - параметры подсветки совпадений
+type HighlightRequest struct {
+	// Style - html или ansi
+	Style string `json:"style"`
+	// FragmentSize - размер фрагмента в символах, 0 - по умолчанию
+	FragmentSize int `json:"fragmentSize"`
+	// Fragments - сколько лучших фрагментов отдавать по каждому полю, 0 - по умолчанию
+	Fragments int `json:"fragments"`
+	// PreTag, PostTag - обрамление совпадения; для ansi PreTag - escape-последовательность цвета
+	PreTag  string `json:"preTag"`
+	PostTag string `json:"postTag"`
+}
+
+// QueryRequest - тело POST /query: запрос в JSON DSL и параметры выдачи как у /search
+type QueryRequest struct {
+	Query         json.RawMessage   `json:"query"`
+	Filters       *FilterRequest    `json:"filters"`
+	SortField     string            `json:"sortField"`
+	SortOrder     string            `json:"sortOrder"`
+	From          int               `json:"from"`
+	Size          int               `json:"size"`
+	Cursor        string            `json:"cursor"`
+	Facets        bool              `json:"facets"`
+	Highlight     *HighlightRequest `json:"highlight"`
+	Fields        []string          `json:"fields"`
+	ExcludeFields []string          `json:"excludeFields"`
+	RankProfile   string            `json:"rankProfile"`
+	Explain       bool              `json:"explain"`
+}
+
+// SuggestRequest - параметры автодополнения
+type SuggestRequest struct {
+	Query   string
+	Filters *FilterRequest
+	Size    int
 }
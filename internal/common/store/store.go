@@ -0,0 +1,140 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// ErrNotFound - элемента с таким id нет
+var ErrNotFound = errors.New("not found")
+
+// Item - элемент хранилища: id и проверка перед сохранением
+type Item interface {
+	GetID() string
+	Validate() error
+}
+
+// Store - элементы с id в JSON-файле рядом с остальными конфигами: список в памяти, каждое изменение записывается в файл
+type Store[T Item] struct {
+	path  string
+	items []T
+	mu    *sync.RWMutex
+}
+
+// Load загружает и проверяет элементы из файла path. Отсутствующий файл - пустое хранилище
+func Load[T Item](path string) (*Store[T], error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return New[T](path, nil), nil
+		}
+		return nil, err
+	}
+
+	var items []T
+	err = json.Unmarshal(data, &items)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		if err = item.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return New(path, items), nil
+}
+
+// New создает хранилище с уже загруженными элементами
+func New[T Item](path string, items []T) *Store[T] {
+	if items == nil {
+		items = []T{}
+	}
+	return &Store[T]{path: path, items: items, mu: new(sync.RWMutex)}
+}
+
+// GetAll возвращает копию всех элементов в порядке файла
+func (s *Store[T]) GetAll() []T {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := make([]T, len(s.items))
+	copy(items, s.items)
+	return items
+}
+
+// Get возвращает элемент по id
+func (s *Store[T]) Get(id string) (T, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, item := range s.items {
+		if item.GetID() == id {
+			return item, true
+		}
+	}
+	var empty T
+	return empty, false
+}
+
+// Upsert проверяет элемент, заменяет элемент с тем же id или добавляет в конец и сохраняет файл
+func (s *Store[T]) Upsert(item T) error {
+	err := item.Validate()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := make([]T, 0, len(s.items)+1)
+	replaced := false
+	for _, existing := range s.items {
+		if existing.GetID() == item.GetID() {
+			items = append(items, item)
+			replaced = true
+			continue
+		}
+		items = append(items, existing)
+	}
+	if !replaced {
+		items = append(items, item)
+	}
+
+	return s.save(items)
+}
+
+// Delete удаляет элемент по id и сохраняет файл
+func (s *Store[T]) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := make([]T, 0, len(s.items))
+	for _, item := range s.items {
+		if item.GetID() != id {
+			items = append(items, item)
+		}
+	}
+	if len(items) == len(s.items) {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+
+	return s.save(items)
+}
+
+// save записывает элементы в файл и только после успешной записи заменяет список в памяти
+func (s *Store[T]) save(items []T) error {
+	data, err := json.MarshalIndent(items, "", " ")
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(s.path, data, 0644)
+	if err != nil {
+		return err
+	}
+	s.items = items
+	return nil
+}
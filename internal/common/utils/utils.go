@@ -7,7 +7,7 @@ import (
 
 func Recovery(service string) {
 	if recoveryMessage := recover(); recoveryMessage != nil {
-		log.Println("[%s][RECOVERY] Panic message: %s\n", service, recoveryMessage)
-		log.Println("[%s][RECOVERY] Panic Stacktrace:\n%s\n", service, string(debug.Stack()))
+		log.Printf("[%s][RECOVERY] Panic message: %s\n", service, recoveryMessage)
+		log.Printf("[%s][RECOVERY] Panic Stacktrace:\n%s\n", service, string(debug.Stack()))
 	}
 }
@@ -7,6 +7,8 @@ import (
 	"github.com/kelseyhightower/envconfig"
 	"log"
 	"os"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -21,6 +23,14 @@ type Config struct {
 	IndexCfg        *IndexConfig
 	IndexConfigPath string `envconfig:"INDEX_CONFIG_PATH" required:"true"`
 
+	// search
+	SearchDefaultSize int `envconfig:"SEARCH_DEFAULT_SIZE" default:"10"`
+	SearchMaxSize     int `envconfig:"SEARCH_MAX_SIZE" default:"100"`
+	// GetAllMaxSize - размер страницы обхода документов курсором в /getAllDoc: по умолчанию и максимум
+	GetAllMaxSize int `envconfig:"GET_ALL_MAX_SIZE" default:"1000"`
+	// SpellDictTTL - как часто перестраивать словарь исправления опечаток
+	SpellDictTTL time.Duration `envconfig:"SPELL_DICT_TTL" default:"5m"`
+
 	// filter
 	DateLayout       string `envconfig:"DATE_LAYOUT" required:"true"`
 	FilterConfigPath string `envconfig:"FILTER_CONFIG_PATH" required:"true"`
@@ -30,6 +40,24 @@ type Config struct {
 	RankCfg        *RankConfig
 	RankConfigPath string `envconfig:"RANK_CONFIG_PATH" required:"true"`
 
+	// synonyms
+	SynonymCfg        []SynonymRule
+	SynonymConfigPath string `envconfig:"SYNONYM_CONFIG_PATH" default:"/synonym_config.json"`
+
+	// query rewriting
+	RewriteCfg        *RewriteConfig
+	RewriteConfigPath string `envconfig:"REWRITE_CONFIG_PATH" default:"/rewrite.json"`
+
+	// experiments
+	ExperimentCfg        []ExperimentConfig
+	ExperimentConfigPath string `envconfig:"EXPERIMENT_CONFIG_PATH" default:"/experiments.json"`
+
+	// merchandising rules
+	RulesConfigPath string `envconfig:"RULES_CONFIG_PATH" default:"/rules.json"`
+
+	// evaluation
+	JudgmentConfigPath string `envconfig:"JUDGMENT_CONFIG_PATH" default:"/judgments.json"`
+
 	// logs
 	LogsDir string `envconfig:"LOGS_DIR" required:"true"`
 
@@ -74,6 +102,21 @@ func LoadConfig() *Config {
 		log.Fatalln("[CONFIG][ERROR] error while loading rank config:", err)
 	}
 
+	cfg.SynonymCfg, err = LoadSynonymConfig(fmt.Sprintf("%s%s", cfg.CfgDirPath, cfg.SynonymConfigPath))
+	if err != nil {
+		log.Fatalln("[CONFIG][ERROR] error while loading synonym config:", err)
+	}
+
+	cfg.RewriteCfg, err = LoadRewriteConfig(fmt.Sprintf("%s%s", cfg.CfgDirPath, cfg.RewriteConfigPath))
+	if err != nil {
+		log.Fatalln("[CONFIG][ERROR] error while loading rewrite config:", err)
+	}
+
+	cfg.ExperimentCfg, err = LoadExperimentConfig(fmt.Sprintf("%s%s", cfg.CfgDirPath, cfg.ExperimentConfigPath))
+	if err != nil {
+		log.Fatalln("[CONFIG][ERROR] error while loading experiment config:", err)
+	}
+
 	if cfg.NatsURL != "" && cfg.NatsSubject != "" {
 		cfg.EnableNatsSubscriber = true
 	}
@@ -93,11 +136,26 @@ func (c *Config) PrintConfig() {
 	log.Println("INDEX_PATH.................... ", c.IndexPath)
 	log.Println("INDEX_NAME.................... ", c.IndexCfg.IndexName)
 	log.Println("INDEX_CONFIG_PATH............. ", c.IndexConfigPath)
+	log.Println("_____________SEARCH____________ ")
+	log.Println("SEARCH_DEFAULT_SIZE............ ", c.SearchDefaultSize)
+	log.Println("SEARCH_MAX_SIZE................ ", c.SearchMaxSize)
+	log.Println("GET_ALL_MAX_SIZE............... ", c.GetAllMaxSize)
+	log.Println("SPELL_DICT_TTL................. ", c.SpellDictTTL)
 	log.Println("_____________FILTER____________ ")
 	log.Println("FILTER_CONFIG_PATH............. ", c.FilterConfigPath)
 	log.Println("DATE_LAYOUT.................... ", c.DateLayout)
 	log.Println("______________RANK_____________ ")
 	log.Println("RANK_CONFIG_PATH............... ", c.RankConfigPath)
+	log.Println("____________SYNONYM____________ ")
+	log.Println("SYNONYM_CONFIG_PATH............ ", c.SynonymConfigPath)
+	log.Println("____________REWRITE____________ ")
+	log.Println("REWRITE_CONFIG_PATH............ ", c.RewriteConfigPath)
+	log.Println("_____________RULES_____________ ")
+	log.Println("RULES_CONFIG_PATH.............. ", c.RulesConfigPath)
+	log.Println("__________EXPERIMENTS__________ ")
+	log.Println("EXPERIMENT_CONFIG_PATH......... ", c.ExperimentConfigPath)
+	log.Println("___________EVALUATION__________ ")
+	log.Println("JUDGMENT_CONFIG_PATH........... ", c.JudgmentConfigPath)
 	if c.EnableNatsSubscriber || c.EnableKafkaSubscriber {
 		log.Println("___________SUBSCRIBER__________ ")
 	}
@@ -128,6 +186,10 @@ type FieldConfig struct {
 	Filterable bool   `json:"filterable,omitempty"`
 	Sortable   bool   `json:"sortable,omitempty"`
 	Synonym    bool   `json:"synonym,omitempty"`
+	Analyzer   string `json:"analyzer,omitempty"`
+	Language   string `json:"language,omitempty"`
+	// Suggest - индексировать префиксы значений поля для автодополнения (/suggest)
+	Suggest bool `json:"suggest,omitempty"`
 }
 
 // IndexConfig описывает конфигурацию индекса
@@ -135,6 +197,45 @@ type IndexConfig struct {
 	IndexName string        `json:"indexName"`
 	Category  []string      `json:"category,omitempty"`
 	Fields    []FieldConfig `json:"fields"`
+
+	// Анализатор по умолчанию для всего индекса, в том числе для полнотекстового поиска (_all)
+	Analyzer string `json:"analyzer,omitempty"`
+	Language string `json:"language,omitempty"`
+	// Пользовательские анализаторы: имя -> цепочка char filters / tokenizer / token filters
+	Analyzers map[string]CustomAnalyzerConfig `json:"analyzers,omitempty"`
+
+	// LayoutFix - искать также по запросу в другой раскладке клавиатуры (ru/en) и транслитерации
+	LayoutFix bool `json:"layoutFix,omitempty"`
+}
+
+// CustomAnalyzerConfig описывает пользовательский анализатор из зарегистрированных в bleve компонентов
+type CustomAnalyzerConfig struct {
+	CharFilters  []string `json:"char_filters,omitempty"`
+	Tokenizer    string   `json:"tokenizer"`
+	TokenFilters []string `json:"token_filters,omitempty"`
+}
+
+const (
+	AnalyzerStandard = "standard"
+	AnalyzerSimple   = "simple"
+	AnalyzerKeyword  = "keyword"
+	AnalyzerRu       = "ru"
+	AnalyzerEn       = "en"
+)
+
+// builtinAnalyzers - встроенные анализаторы bleve, доступные в конфиге
+var builtinAnalyzers = map[string]struct{}{
+	AnalyzerStandard: {},
+	AnalyzerSimple:   {},
+	AnalyzerKeyword:  {},
+	AnalyzerRu:       {},
+	AnalyzerEn:       {},
+}
+
+// languageAnalyzers - соответствие языка анализатору со стеммингом и стоп-словами
+var languageAnalyzers = map[string]string{
+	"ru": AnalyzerRu,
+	"en": AnalyzerEn,
 }
 
 // LoadConfig загружает конфигурацию индекса из файла
@@ -144,7 +245,83 @@ func LoadIndexConfig(filePath string) (*IndexConfig, error) {
 		return nil, err
 	}
 
-	return LoadAnyConfigData[*IndexConfig](file)
+	icfg, err := LoadAnyConfigData[*IndexConfig](file)
+	if err != nil {
+		return nil, err
+	}
+
+	return icfg, icfg.Validate()
+}
+
+// Validate проверяет, что все указанные анализаторы и языки известны
+func (ic *IndexConfig) Validate() error {
+	for name, a := range ic.Analyzers {
+		if _, ok := builtinAnalyzers[name]; ok {
+			return fmt.Errorf("custom analyzer '%s' overrides builtin analyzer", name)
+		}
+		if a.Tokenizer == "" {
+			return fmt.Errorf("custom analyzer '%s': tokenizer is empty", name)
+		}
+	}
+
+	if _, err := ic.resolveAnalyzer(ic.Analyzer, ic.Language); err != nil {
+		return err
+	}
+
+	for _, field := range ic.Fields {
+		if field.Suggest && field.Type != "string" && field.Type != "keyword" {
+			return fmt.Errorf("field '%s': suggest is applicable only to string and keyword fields", field.Name)
+		}
+		if field.Analyzer == "" && field.Language == "" {
+			continue
+		}
+		if field.Type != "string" {
+			return fmt.Errorf("field '%s': analyzer is applicable only to string fields", field.Name)
+		}
+		if _, err := ic.resolveAnalyzer(field.Analyzer, field.Language); err != nil {
+			return fmt.Errorf("field '%s': %w", field.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// IndexAnalyzer возвращает анализатор индекса по умолчанию
+func (ic *IndexConfig) IndexAnalyzer() string {
+	name, _ := ic.resolveAnalyzer(ic.Analyzer, ic.Language)
+	if name == "" {
+		return AnalyzerStandard
+	}
+	return name
+}
+
+// FieldAnalyzer возвращает анализатор поля, пустая строка - анализатор индекса
+func (ic *IndexConfig) FieldAnalyzer(field FieldConfig) string {
+	name, _ := ic.resolveAnalyzer(field.Analyzer, field.Language)
+	return name
+}
+
+// resolveAnalyzer выбирает анализатор: явно указанный analyzer приоритетнее language
+func (ic *IndexConfig) resolveAnalyzer(analyzer, language string) (string, error) {
+	if analyzer != "" {
+		if _, ok := builtinAnalyzers[analyzer]; ok {
+			return analyzer, nil
+		}
+		if _, ok := ic.Analyzers[analyzer]; ok {
+			return analyzer, nil
+		}
+		return "", fmt.Errorf("unknown analyzer: %s", analyzer)
+	}
+
+	if language != "" {
+		name, ok := languageAnalyzers[language]
+		if !ok {
+			return "", fmt.Errorf("unsupported language: %s", language)
+		}
+		return name, nil
+	}
+
+	return "", nil
 }
 
 func LoadAnyConfigData[T any](data []byte) (T, error) {
@@ -158,7 +335,29 @@ func LoadAnyConfigData[T any](data []byte) (T, error) {
 
 // Ranking
 type RankConfig struct {
+	// профиль по умолчанию
+	RankProfile
+	// Profiles - именованные профили ранжирования, выбираются по категории или параметру rankProfile
+	Profiles map[string]RankProfile `json:"profiles,omitempty"`
+}
+
+// RankProfile - настройки ранжирования: бусты полей, функции ранжирования и модель
+type RankProfile struct {
 	Boosts []BoostConfig `json:"boosts"`
+	// RescoreWindow - сколько лучших документов пересчитывается функциями ранжирования (custom, decay, field_value_factor)
+	RescoreWindow int `json:"rescore_window,omitempty"`
+	// Model - модель learning-to-rank, переранжирующая те же лучшие документы
+	Model *ModelConfig `json:"model,omitempty"`
+	// Categories - категории, для которых профиль выбирается по умолчанию
+	Categories []string `json:"categories,omitempty"`
+}
+
+// ModelConfig - модель ансамбля деревьев для переранжирования
+type ModelConfig struct {
+	Path      string   `json:"path"`   // путь к файлу модели внутри CONFIG_DIR_PATH, без ".."
+	Format    string   `json:"format"` // catboost или xgboost
+	Features  []string `json:"features"`
+	BaseScore float64  `json:"base_score,omitempty"` // для xgboost
 }
 
 type BoostConfig struct {
@@ -166,6 +365,38 @@ type BoostConfig struct {
 	Weight    float64 `json:"weight"`
 	BoostType string  `json:"boost_type"`
 	Formula   string  `json:"formula,omitempty"`
+
+	// Decay-функции (gauss, exp, linear): чем дальше значение поля от origin, тем меньше множитель score.
+	// Для timestamp origin - дата или "now", scale и offset - длительность ("12h", "30d"), для number - числа.
+	Origin FlexString `json:"origin,omitempty"`
+	Scale  FlexString `json:"scale,omitempty"`
+	Offset FlexString `json:"offset,omitempty"`
+	Decay  float64    `json:"decay,omitempty"`
+
+	// field_value_factor: множитель score - modifier(factor * значение поля), missing - значение при отсутствии поля
+	Modifier string   `json:"modifier,omitempty"`
+	Factor   float64  `json:"factor,omitempty"`
+	Missing  *float64 `json:"missing,omitempty"`
+}
+
+// FlexString - параметр, который в JSON задается строкой или числом: "30d", "now", 100
+type FlexString string
+
+func (s *FlexString) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var v string
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		*s = FlexString(v)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("expected string or number, got %s", data)
+	}
+	*s = FlexString(n.String())
+	return nil
 }
 
 // LoadConfig загружает конфигурацию индекса из файла
@@ -196,6 +427,8 @@ type RangeFilter struct {
 	Type      string `json:"type"`
 	FromValue string `json:"from_value"`
 	ToValue   string `json:"to_value"`
+	// Price - числовой фильтр цены: в него попадает цена из запроса при intent=true ("до 5000")
+	Price bool `json:"price,omitempty"`
 }
 
 type MultiSelectFilter struct {
@@ -216,3 +449,219 @@ func LoadFilterConfig(filePath string) ([]FilterConfig, error) {
 
 	return LoadAnyConfigData[[]FilterConfig](data)
 }
+
+// Synonyms
+
+const (
+	// SynonymEquivalent - все слова правила взаимозаменяемы
+	SynonymEquivalent = "equivalent"
+	// SynonymOneWay - слова из input раскрываются в synonyms, но не наоборот
+	SynonymOneWay = "one-way"
+)
+
+type SynonymRule struct {
+	ID       string   `json:"id"`
+	Type     string   `json:"type"`
+	Input    []string `json:"input,omitempty"`
+	Synonyms []string `json:"synonyms"`
+}
+
+func (r SynonymRule) GetID() string {
+	return r.ID
+}
+
+// Validate проверяет корректность правила синонимов
+func (r SynonymRule) Validate() error {
+	if r.ID == "" {
+		return fmt.Errorf("synonym rule id is empty")
+	}
+	if len(r.Synonyms) == 0 {
+		return fmt.Errorf("synonym rule '%s': synonyms are empty", r.ID)
+	}
+
+	switch r.Type {
+	case SynonymEquivalent:
+		if len(r.Input) != 0 {
+			return fmt.Errorf("synonym rule '%s': input is not allowed for %s rule", r.ID, SynonymEquivalent)
+		}
+		if len(r.Synonyms) < 2 {
+			return fmt.Errorf("synonym rule '%s': at least two synonyms are required", r.ID)
+		}
+	case SynonymOneWay:
+		if len(r.Input) == 0 {
+			return fmt.Errorf("synonym rule '%s': input is empty", r.ID)
+		}
+	default:
+		return fmt.Errorf("synonym rule '%s': unknown type: %s", r.ID, r.Type)
+	}
+	return nil
+}
+
+// LoadSynonymConfig загружает словарь синонимов. Отсутствующий файл - пустой словарь
+func LoadSynonymConfig(filePath string) ([]SynonymRule, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []SynonymRule{}, nil
+		}
+		return nil, err
+	}
+
+	rules, err := LoadAnyConfigData[[]SynonymRule](data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range rules {
+		if err = r.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// Query rewriting
+
+// RewriteConfig - правила переписывания запроса перед поиском. Фразы сравниваются со словами запроса без учета регистра
+type RewriteConfig struct {
+	// StopWords - слова и фразы, которые удаляются из запроса ("купить", "недорого")
+	StopWords []string `json:"stopWords,omitempty"`
+	// Replacements - замены слов и фраз запроса ("найк" -> "nike")
+	Replacements []RewriteReplacement `json:"replacements,omitempty"`
+	// Filters - фразы, которые удаляются из запроса и становятся фильтром ("красная" -> color=красная)
+	Filters []RewriteFilter `json:"filters,omitempty"`
+}
+
+type RewriteReplacement struct {
+	From []string `json:"from"`
+	To   string   `json:"to"`
+}
+
+// RewriteFilter - фразы, которые превращаются в значение фильтра Name (multi-select)
+type RewriteFilter struct {
+	From  []string `json:"from"`
+	Name  string   `json:"name"`
+	Value string   `json:"value"`
+}
+
+// Validate проверяет, что фразы и значения правил не пустые
+func (rc *RewriteConfig) Validate() error {
+	for i, w := range rc.StopWords {
+		if strings.TrimSpace(w) == "" {
+			return fmt.Errorf("stopWords[%d] is empty", i)
+		}
+	}
+	for i, r := range rc.Replacements {
+		if len(r.From) == 0 {
+			return fmt.Errorf("replacements[%d]: from is empty", i)
+		}
+		if strings.TrimSpace(r.To) == "" {
+			return fmt.Errorf("replacements[%d]: to is empty, use stopWords to remove words", i)
+		}
+	}
+	for i, f := range rc.Filters {
+		if len(f.From) == 0 {
+			return fmt.Errorf("filters[%d]: from is empty", i)
+		}
+		if f.Name == "" || f.Value == "" {
+			return fmt.Errorf("filters[%d]: name and value are required", i)
+		}
+	}
+	return nil
+}
+
+// ValidateFilters проверяет, что фильтры правил есть среди multi-select фильтров конфига фильтров:
+// опечатка в имени превратила бы фразу в фильтр по несуществующему полю и запрос ничего бы не находил
+func (rc *RewriteConfig) ValidateFilters(filterCfgs []FilterConfig) error {
+	names := make(map[string]struct{})
+	for _, fc := range filterCfgs {
+		for _, f := range fc.MultiSelect {
+			names[f.Name] = struct{}{}
+		}
+	}
+	for i, f := range rc.Filters {
+		if _, ok := names[f.Name]; !ok {
+			return fmt.Errorf("filters[%d]: %s is not a multi-select filter in filter config", i, f.Name)
+		}
+	}
+	return nil
+}
+
+// LoadRewriteConfig загружает правила переписывания запроса. Отсутствующий файл - запрос не переписывается
+func LoadRewriteConfig(filePath string) (*RewriteConfig, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &RewriteConfig{}, nil
+		}
+		return nil, err
+	}
+
+	return LoadAnyConfigData[*RewriteConfig](data)
+}
+
+// Experiments
+
+// ExperimentConfig - A/B эксперимент: трафик делится между вариантами по хешу id пользователя или сессии из заголовка
+type ExperimentConfig struct {
+	ID string `json:"id"`
+	// Header - заголовок запроса с id пользователя или сессии; запросы без него в эксперимент не попадают
+	Header   string              `json:"header"`
+	Disabled bool                `json:"disabled,omitempty"`
+	Variants []ExperimentVariant `json:"variants"`
+}
+
+// ExperimentVariant - вариант эксперимента: доля трафика и параметры поиска.
+// Незаданные параметры берутся из запроса или по умолчанию.
+type ExperimentVariant struct {
+	Name string `json:"name"`
+	// Weight - доля трафика относительно суммы весов вариантов
+	Weight      int    `json:"weight"`
+	RankProfile string `json:"rankProfile,omitempty"`
+	AutoCorrect *bool  `json:"autocorrect,omitempty"`
+	Fuzziness   *int   `json:"fuzziness,omitempty"`
+}
+
+// Validate проверяет корректность эксперимента
+func (e ExperimentConfig) Validate() error {
+	if e.ID == "" {
+		return fmt.Errorf("experiment id is empty")
+	}
+	if e.Header == "" {
+		return fmt.Errorf("experiment '%s': header is empty", e.ID)
+	}
+	if len(e.Variants) < 2 {
+		return fmt.Errorf("experiment '%s': at least two variants are required", e.ID)
+	}
+
+	names := make(map[string]struct{}, len(e.Variants))
+	for i, v := range e.Variants {
+		if v.Name == "" {
+			return fmt.Errorf("experiment '%s': variants[%d]: name is empty", e.ID, i)
+		}
+		if _, ok := names[v.Name]; ok {
+			return fmt.Errorf("experiment '%s': duplicate variant %s", e.ID, v.Name)
+		}
+		names[v.Name] = struct{}{}
+		if v.Weight <= 0 {
+			return fmt.Errorf("experiment '%s': variant %s: weight must be > 0", e.ID, v.Name)
+		}
+		if v.Fuzziness != nil && (*v.Fuzziness < 0 || *v.Fuzziness > 2) {
+			return fmt.Errorf("experiment '%s': variant %s: fuzziness must be between 0 and 2", e.ID, v.Name)
+		}
+	}
+	return nil
+}
+
+// LoadExperimentConfig загружает эксперименты. Отсутствующий файл - нет экспериментов
+func LoadExperimentConfig(filePath string) ([]ExperimentConfig, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []ExperimentConfig{}, nil
+		}
+		return nil, err
+	}
+
+	return LoadAnyConfigData[[]ExperimentConfig](data)
+}
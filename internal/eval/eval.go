@@ -0,0 +1,199 @@
+package eval
+
+import (
+	"errors"
+	"fmt"
+	"searchengine/internal/common/request"
+	"searchengine/internal/common/store"
+	"searchengine/internal/config"
+	"searchengine/internal/search"
+)
+
+// defaultK - глубина оценки выдачи, если k не задан
+const defaultK = 10
+
+var (
+	// ErrUnknownList - списка оценок с таким id нет
+	ErrUnknownList = errors.New("unknown judgment list")
+	// ErrInvalidRankConfig - конфиг-кандидат ранжирования не прошел проверку
+	ErrInvalidRankConfig = errors.New("invalid rank config")
+)
+
+// JudgmentList - список оценок: запросы и оценки релевантности документов для каждого запроса
+type JudgmentList struct {
+	ID          string        `json:"id"`
+	Description string        `json:"description,omitempty"`
+	Queries     []JudgedQuery `json:"queries"`
+}
+
+// JudgedQuery - запрос с оценками документов: docId -> оценка (0 - нерелевантен, чем больше, тем релевантнее).
+// Filters и RankProfile передаются в поиск как параметры /search.
+type JudgedQuery struct {
+	Query       string                 `json:"query"`
+	Filters     *request.FilterRequest `json:"filters,omitempty"`
+	RankProfile string                 `json:"rankProfile,omitempty"`
+	Ratings     map[string]int         `json:"ratings"`
+}
+
+func (l JudgmentList) GetID() string {
+	return l.ID
+}
+
+// Validate проверяет корректность списка оценок
+func (l JudgmentList) Validate() error {
+	if l.ID == "" {
+		return fmt.Errorf("judgment list id is empty")
+	}
+	if len(l.Queries) == 0 {
+		return fmt.Errorf("judgment list '%s': queries are empty", l.ID)
+	}
+	for i, q := range l.Queries {
+		if q.Query == "" {
+			return fmt.Errorf("judgment list '%s': queries[%d]: query is empty", l.ID, i)
+		}
+		relevant := false
+		for id, grade := range q.Ratings {
+			if grade < 0 {
+				return fmt.Errorf("judgment list '%s': queries[%d]: negative grade for %s", l.ID, i, id)
+			}
+			relevant = relevant || grade > 0
+		}
+		// без релевантных документов NDCG и MRR запроса не определены
+		if !relevant {
+			return fmt.Errorf("judgment list '%s': queries[%d]: no document with grade > 0", l.ID, i)
+		}
+	}
+	return nil
+}
+
+// RunRequest - параметры оценки: список оценок, глубина k и конфиг-кандидат ранжирования.
+// Без кандидата оценивается только текущий конфиг.
+type RunRequest struct {
+	List       string             `json:"list"`
+	K          int                `json:"k"`
+	RankConfig *config.RankConfig `json:"rankConfig,omitempty"`
+}
+
+// Report - результат оценки: средние метрики по запросам для текущего конфига и кандидата и разница по каждому запросу
+type Report struct {
+	List      string        `json:"list"`
+	K         int           `json:"k"`
+	Current   Metrics       `json:"current"`
+	Candidate *Metrics      `json:"candidate,omitempty"`
+	Delta     *Metrics      `json:"delta,omitempty"`
+	Queries   []QueryReport `json:"queries"`
+}
+
+// QueryReport - метрики одного запроса; Delta - кандидат минус текущий конфиг
+type QueryReport struct {
+	Query     string       `json:"query"`
+	Current   QueryResult  `json:"current"`
+	Candidate *QueryResult `json:"candidate,omitempty"`
+	Delta     *Metrics     `json:"delta,omitempty"`
+}
+
+// QueryResult - первые k документов выдачи и их метрики
+type QueryResult struct {
+	Metrics
+	Hits []string `json:"hits"`
+	// Unjudged - сколько документов выдачи не оценено; такие документы считаются нерелевантными
+	Unjudged    int    `json:"unjudged"`
+	RankProfile string `json:"rank_profile"`
+}
+
+// EvalClient - списки оценок из JUDGMENT_CONFIG_PATH и их оценка; GetAll, Get, Upsert и Delete - от хранилища
+type EvalClient struct {
+	*store.Store[JudgmentList]
+
+	cfg       *config.Config
+	searchCli *search.SearchClient
+}
+
+// New загружает списки оценок из JUDGMENT_CONFIG_PATH. Отсутствующий файл - нет списков
+func New(cfg *config.Config, searchCli *search.SearchClient) (*EvalClient, error) {
+	st, err := store.Load[JudgmentList](fmt.Sprintf("%s%s", cfg.CfgDirPath, cfg.JudgmentConfigPath))
+	if err != nil {
+		return nil, err
+	}
+	return &EvalClient{Store: st, cfg: cfg, searchCli: searchCli}, nil
+}
+
+// Run выполняет запросы списка оценок по живому индексу с текущим конфигом ранжирования и, если задан, с кандидатом,
+// и считает NDCG@k, MRR и precision@k. Кандидат не применяется и не сохраняется.
+func (ec *EvalClient) Run(req RunRequest) (*Report, error) {
+	list, ok := ec.Get(req.List)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownList, req.List)
+	}
+	k := req.K
+	if k == 0 {
+		k = defaultK
+	}
+	if k < 0 || k > ec.cfg.SearchMaxSize {
+		return nil, fmt.Errorf("k must be between 1 and %d", ec.cfg.SearchMaxSize)
+	}
+
+	var candidateCli *search.SearchClient
+	if req.RankConfig != nil {
+		rankCli, err := ec.searchCli.RankCli.Candidate(req.RankConfig)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidRankConfig, err)
+		}
+		candidateCli = ec.searchCli.WithRanking(rankCli)
+	}
+
+	report := &Report{List: list.ID, K: k, Queries: make([]QueryReport, 0, len(list.Queries))}
+	var current, candidate Metrics
+	for _, q := range list.Queries {
+		qr := QueryReport{Query: q.Query}
+		res, err := evalQuery(ec.searchCli, q, k)
+		if err != nil {
+			return nil, err
+		}
+		qr.Current = *res
+		current.add(res.Metrics)
+
+		if candidateCli != nil {
+			qr.Candidate, err = evalQuery(candidateCli, q, k)
+			if err != nil {
+				return nil, err
+			}
+			delta := qr.Candidate.Metrics.sub(qr.Current.Metrics)
+			qr.Delta = &delta
+			candidate.add(qr.Candidate.Metrics)
+		}
+		report.Queries = append(report.Queries, qr)
+	}
+
+	report.Current = current.mean(len(list.Queries))
+	if candidateCli != nil {
+		candidate = candidate.mean(len(list.Queries))
+		delta := candidate.sub(report.Current)
+		report.Candidate, report.Delta = &candidate, &delta
+	}
+	return report, nil
+}
+
+// evalQuery выполняет запрос как /search и считает метрики первых k документов
+func evalQuery(sc *search.SearchClient, q JudgedQuery, k int) (*QueryResult, error) {
+	result, err := sc.AdvancedSearch(&request.SearchRequest{
+		Query:       q.Query,
+		Filters:     q.Filters,
+		RankProfile: q.RankProfile,
+		Size:        k,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("query %q: %w", q.Query, err)
+	}
+
+	res := &QueryResult{Hits: make([]string, 0, len(result.Hits)), RankProfile: result.RankProfile}
+	for _, hit := range result.Hits {
+		id := fmt.Sprint(hit["id"])
+		res.Hits = append(res.Hits, id)
+		if _, ok := q.Ratings[id]; !ok {
+			res.Unjudged++
+		}
+	}
+	res.Metrics = queryMetrics(res.Hits, q.Ratings, k)
+	return res, nil
+}
@@ -0,0 +1,75 @@
+package eval
+
+import (
+	"math"
+	"slices"
+)
+
+// Metrics - метрики качества выдачи на первых k документах
+type Metrics struct {
+	NDCG      float64 `json:"ndcg"`
+	MRR       float64 `json:"mrr"`
+	Precision float64 `json:"precision"`
+}
+
+// queryMetrics считает метрики по id документов выдачи и оценкам запроса.
+// Документ без оценки считается нерелевантным (оценка 0), выдача должна быть не длиннее k.
+func queryMetrics(hits []string, ratings map[string]int, k int) Metrics {
+	var m Metrics
+	dcg, relevant := 0.0, 0
+	for i, id := range hits {
+		grade := ratings[id]
+		if grade <= 0 {
+			continue
+		}
+		dcg += gain(grade, i)
+		relevant++
+		if m.MRR == 0 {
+			m.MRR = 1 / float64(i+1)
+		}
+	}
+	m.Precision = float64(relevant) / float64(k)
+
+	// идеальная выдача - все оцененные документы по убыванию оценки
+	grades := make([]int, 0, len(ratings))
+	for _, grade := range ratings {
+		grades = append(grades, grade)
+	}
+	slices.Sort(grades)
+	slices.Reverse(grades)
+	idcg := 0.0
+	for i, grade := range grades[:min(k, len(grades))] {
+		if grade > 0 {
+			idcg += gain(grade, i)
+		}
+	}
+	if idcg > 0 {
+		m.NDCG = dcg / idcg
+	}
+	return m
+}
+
+// gain - вклад документа с оценкой grade на позиции i (с 0) в DCG: (2^grade - 1) / log2(i + 2)
+func gain(grade, i int) float64 {
+	return (math.Pow(2, float64(grade)) - 1) / math.Log2(float64(i+2))
+}
+
+// add прибавляет метрики запроса к сумме
+func (m *Metrics) add(o Metrics) {
+	m.NDCG += o.NDCG
+	m.MRR += o.MRR
+	m.Precision += o.Precision
+}
+
+// mean делит сумму метрик на количество запросов
+func (m Metrics) mean(n int) Metrics {
+	if n == 0 {
+		return m
+	}
+	return Metrics{NDCG: m.NDCG / float64(n), MRR: m.MRR / float64(n), Precision: m.Precision / float64(n)}
+}
+
+// sub - разница метрик m - o
+func (m Metrics) sub(o Metrics) Metrics {
+	return Metrics{NDCG: m.NDCG - o.NDCG, MRR: m.MRR - o.MRR, Precision: m.Precision - o.Precision}
+}
@@ -0,0 +1,200 @@
+package experiment
+
+import (
+	"fmt"
+	"hash/fnv"
+	"searchengine/internal/common/request"
+	"searchengine/internal/config"
+	"searchengine/internal/rank"
+	"sync"
+)
+
+// Параметры поиска, которые может задавать вариант эксперимента; совпадают с параметрами /search
+const (
+	OptionRankProfile = "rankProfile"
+	OptionAutoCorrect = "autocorrect"
+	OptionFuzziness   = "fuzziness"
+)
+
+// Assignment - вариант эксперимента, назначенный запросу
+type Assignment struct {
+	Experiment string `json:"experiment"`
+	Variant    string `json:"variant"`
+
+	variant config.ExperimentVariant
+}
+
+type ExperimentClient struct {
+	experiments []config.ExperimentConfig
+	mu          *sync.RWMutex
+}
+
+// New проверяет эксперименты из конфига по конфигу ранжирования
+func New(cfg *config.Config) (*ExperimentClient, error) {
+	ec := &ExperimentClient{mu: new(sync.RWMutex)}
+	if err := ec.SetCfg(cfg.ExperimentCfg, cfg.RankCfg); err != nil {
+		return nil, err
+	}
+	return ec, nil
+}
+
+// GetAll возвращает все эксперименты
+func (ec *ExperimentClient) GetAll() []config.ExperimentConfig {
+	ec.mu.RLock()
+	defer ec.mu.RUnlock()
+
+	experiments := make([]config.ExperimentConfig, len(ec.experiments))
+	copy(experiments, ec.experiments)
+	return experiments
+}
+
+// SetCfg проверяет эксперименты и применяет их. При ошибке текущие эксперименты не меняются
+func (ec *ExperimentClient) SetCfg(experiments []config.ExperimentConfig, rankCfg *config.RankConfig) error {
+	if err := Validate(experiments, rankCfg); err != nil {
+		return err
+	}
+
+	ec.mu.Lock()
+	ec.experiments = experiments
+	ec.mu.Unlock()
+	return nil
+}
+
+// CheckRankConfig проверяет, что в новом конфиге ранжирования есть профили, которые используют эксперименты
+func (ec *ExperimentClient) CheckRankConfig(rankCfg *config.RankConfig) error {
+	ec.mu.RLock()
+	defer ec.mu.RUnlock()
+
+	for _, e := range ec.experiments {
+		if err := checkProfiles(e, rankCfg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate проверяет эксперименты: каждый по отдельности, уникальность id, существование профилей ранжирования
+// и то, что включенные эксперименты не задают одни и те же параметры поиска - иначе их результаты нельзя разделить
+func Validate(experiments []config.ExperimentConfig, rankCfg *config.RankConfig) error {
+	ids := make(map[string]struct{}, len(experiments))
+	owners := make(map[string]string)
+	for _, e := range experiments {
+		if err := e.Validate(); err != nil {
+			return err
+		}
+		if _, ok := ids[e.ID]; ok {
+			return fmt.Errorf("duplicate experiment %s", e.ID)
+		}
+		ids[e.ID] = struct{}{}
+		if err := checkProfiles(e, rankCfg); err != nil {
+			return err
+		}
+		if e.Disabled {
+			continue
+		}
+
+		for _, option := range options(e) {
+			if other, ok := owners[option]; ok {
+				return fmt.Errorf("experiments '%s' and '%s' both set %s", other, e.ID, option)
+			}
+			owners[option] = e.ID
+		}
+	}
+	return nil
+}
+
+// checkProfiles проверяет, что профили ранжирования вариантов есть в конфиге ранжирования
+func checkProfiles(e config.ExperimentConfig, rankCfg *config.RankConfig) error {
+	for _, v := range e.Variants {
+		if v.RankProfile == "" || v.RankProfile == rank.DefaultProfile {
+			continue
+		}
+		if _, ok := rankCfg.Profiles[v.RankProfile]; !ok {
+			return fmt.Errorf("experiment '%s': variant %s: %w: %s", e.ID, v.Name, rank.ErrUnknownProfile, v.RankProfile)
+		}
+	}
+	return nil
+}
+
+// options - параметры поиска, которые задает хотя бы один вариант эксперимента
+func options(e config.ExperimentConfig) []string {
+	set := make(map[string]struct{})
+	for _, v := range e.Variants {
+		if v.RankProfile != "" {
+			set[OptionRankProfile] = struct{}{}
+		}
+		if v.AutoCorrect != nil {
+			set[OptionAutoCorrect] = struct{}{}
+		}
+		if v.Fuzziness != nil {
+			set[OptionFuzziness] = struct{}{}
+		}
+	}
+	opts := make([]string, 0, len(set))
+	for _, option := range []string{OptionRankProfile, OptionAutoCorrect, OptionFuzziness} {
+		if _, ok := set[option]; ok {
+			opts = append(opts, option)
+		}
+	}
+	return opts
+}
+
+// Assign назначает варианты включенных экспериментов по значению их заголовков.
+// Один и тот же id всегда получает один и тот же вариант, пока не изменились варианты и их веса.
+func (ec *ExperimentClient) Assign(header func(name string) string) []Assignment {
+	ec.mu.RLock()
+	defer ec.mu.RUnlock()
+
+	var assignments []Assignment
+	for _, e := range ec.experiments {
+		if e.Disabled {
+			continue
+		}
+		id := header(e.Header)
+		if id == "" {
+			continue
+		}
+		v := pick(e, id)
+		assignments = append(assignments, Assignment{Experiment: e.ID, Variant: v.Name, variant: v})
+	}
+	return assignments
+}
+
+// pick выбирает вариант по хешу id эксперимента и id пользователя: в каждом эксперименте трафик делится независимо
+func pick(e config.ExperimentConfig, id string) config.ExperimentVariant {
+	total := 0
+	for _, v := range e.Variants {
+		total += v.Weight
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(e.ID))
+	h.Write([]byte{0})
+	h.Write([]byte(id))
+	bucket := int(h.Sum64() % uint64(total))
+	for _, v := range e.Variants {
+		if bucket < v.Weight {
+			return v
+		}
+		bucket -= v.Weight
+	}
+	return e.Variants[len(e.Variants)-1]
+}
+
+// Apply применяет параметры назначенных вариантов к запросу.
+// explicit сообщает, что параметр явно задан в запросе, - такой параметр не меняется.
+func Apply(req *request.SearchRequest, assignments []Assignment, explicit func(option string) bool) {
+	for _, a := range assignments {
+		v := a.variant
+		if v.RankProfile != "" && !explicit(OptionRankProfile) {
+			req.RankProfile = v.RankProfile
+		}
+		if v.AutoCorrect != nil && !explicit(OptionAutoCorrect) {
+			req.AutoCorrect = *v.AutoCorrect
+		}
+		if v.Fuzziness != nil && !explicit(OptionFuzziness) {
+			fuzziness := *v.Fuzziness
+			req.Fuzziness = &fuzziness
+		}
+	}
+}
@@ -0,0 +1,469 @@
+package filter
+
+import (
+	"fmt"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search"
+	"searchengine/internal/common/request"
+	"searchengine/internal/config"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FacetTypeRange       = "range"
+	FacetTypeMultiSelect = "multi-select"
+	FacetTypeOneSelect   = "one-select"
+	FacetTypeBoolSelect  = "bool-select"
+
+	// facetTermsSize - сколько значений bleve считает для терминов одного фасета
+	facetTermsSize = 1000
+
+	// numericBucketCount - на сколько интервалов делится числовой диапазон из конфига
+	numericBucketCount = 5
+)
+
+// Facet - значения одного фильтра категории с количеством документов по текущему запросу
+type Facet struct {
+	Name   string       `json:"name"`
+	Type   string       `json:"type"`
+	Values []FacetValue `json:"values,omitempty"`
+	Ranges []FacetRange `json:"ranges,omitempty"`
+}
+
+// FacetValue - значение multi-select, one-select или bool-select фильтра
+type FacetValue struct {
+	Value    string `json:"value"`
+	Count    int    `json:"count"`
+	Selected bool   `json:"selected"`
+}
+
+// FacetRange - интервал range фильтра. Пустая граница - интервал открыт с этой стороны.
+// Значения границ в формате, который принимает range фильтр (число или RFC3339).
+type FacetRange struct {
+	Name  string `json:"name"`
+	From  string `json:"from,omitempty"`
+	To    string `json:"to,omitempty"`
+	Count int    `json:"count"`
+}
+
+// FacetQuery - часть фасетов, которые считаются по одному набору фильтров.
+// Фасет выбранного фильтра считается без самого этого фильтра (disjunctive faceting),
+// иначе выбор одного бренда обнулил бы счетчики остальных.
+type FacetQuery struct {
+	// Exclude - фильтр, который исключен из Filters; пустой для фасетов основного запроса
+	Exclude string
+	Filters *request.FilterRequest
+	Facets  bleve.FacetsRequest
+}
+
+type numericBucket struct {
+	FacetRange
+	min, max *float64
+}
+
+type dateBucket struct {
+	FacetRange
+	start, end time.Time
+}
+
+// FacetQueries строит запросы фасетов для фильтров категории из запроса.
+// Если категория не выбрана - для фильтров всех категорий.
+func (fc *FilterClient) FacetQueries(filters *request.FilterRequest) ([]FacetQuery, error) {
+	fcfg := fc.facetConfig(filters)
+	selected := selectedFilters(filters)
+
+	main := FacetQuery{Filters: filters, Facets: bleve.FacetsRequest{}}
+	queries := make([]FacetQuery, 0)
+	add := func(name string, fr *bleve.FacetRequest) {
+		if !selected[name] {
+			main.Facets[name] = fr
+			return
+		}
+		queries = append(queries, FacetQuery{
+			Exclude: name,
+			Filters: withoutFilter(filters, name),
+			Facets:  bleve.FacetsRequest{name: fr},
+		})
+	}
+
+	for _, r := range fcfg.Range {
+		// размер запроса фасета ограничивает и количество интервалов в ответе
+		var fr *bleve.FacetRequest
+		switch r.Type {
+		case "number":
+			buckets, err := numericBuckets(r)
+			if err != nil {
+				return nil, fmt.Errorf("range facet error (%s): %v", r.Name, err)
+			}
+			fr = bleve.NewFacetRequest(r.Name, len(buckets))
+			for _, b := range buckets {
+				fr.AddNumericRange(b.Name, b.min, b.max)
+			}
+		case "timestamp":
+			buckets, err := fc.dateBuckets(r)
+			if err != nil {
+				return nil, fmt.Errorf("range facet error (%s): %v", r.Name, err)
+			}
+			fr = bleve.NewFacetRequest(r.Name, len(buckets))
+			for _, b := range buckets {
+				fr.AddDateTimeRange(b.Name, b.start, b.end)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported range type: %s", r.Type)
+		}
+		add(r.Name, fr)
+	}
+	for _, ms := range fcfg.MultiSelect {
+		add(ms.Name, bleve.NewFacetRequest(ms.Name, facetTermsSize))
+	}
+	for _, os := range fcfg.OneSelect {
+		add(os.Name, bleve.NewFacetRequest(os.Name, facetTermsSize))
+	}
+	for _, bs := range fcfg.BoolSelect {
+		add(bs.Name, bleve.NewFacetRequest(bs.Name, 2))
+	}
+
+	return append([]FacetQuery{main}, queries...), nil
+}
+
+// BuildFacets собирает ответ из результатов всех FacetQueries в порядке фильтров конфига
+func (fc *FilterClient) BuildFacets(filters *request.FilterRequest, results search.FacetResults) ([]Facet, error) {
+	fcfg := fc.facetConfig(filters)
+	facets := make([]Facet, 0)
+
+	for _, r := range fcfg.Range {
+		facet := Facet{Name: r.Name, Type: FacetTypeRange, Ranges: make([]FacetRange, 0)}
+		res := results[r.Name]
+		switch r.Type {
+		case "number":
+			buckets, err := numericBuckets(r)
+			if err != nil {
+				return nil, fmt.Errorf("range facet error (%s): %v", r.Name, err)
+			}
+			counts := make(map[string]int)
+			if res != nil {
+				for _, nr := range res.NumericRanges {
+					counts[nr.Name] = nr.Count
+				}
+			}
+			for _, b := range buckets {
+				b.Count = counts[b.Name]
+				facet.Ranges = append(facet.Ranges, b.FacetRange)
+			}
+		case "timestamp":
+			buckets, err := fc.dateBuckets(r)
+			if err != nil {
+				return nil, fmt.Errorf("range facet error (%s): %v", r.Name, err)
+			}
+			counts := make(map[string]int)
+			if res != nil {
+				for _, dr := range res.DateRanges {
+					counts[dr.Name] = dr.Count
+				}
+			}
+			for _, b := range buckets {
+				b.Count = counts[b.Name]
+				facet.Ranges = append(facet.Ranges, b.FacetRange)
+			}
+		}
+		facets = append(facets, facet)
+	}
+
+	// Значения keyword полей индексируются в нижнем регистре, в ответ отдаем значения из конфига
+	chosen := selectedValues(filters)
+	for _, ms := range fcfg.MultiSelect {
+		facets = append(facets, termsFacet(ms.Name, FacetTypeMultiSelect, ms.Value, results[ms.Name], chosen[ms.Name]))
+	}
+	for _, os := range fcfg.OneSelect {
+		facets = append(facets, termsFacet(os.Name, FacetTypeOneSelect, os.Value, results[os.Name], chosen[os.Name]))
+	}
+	for _, bs := range fcfg.BoolSelect {
+		counts := termCounts(results[bs.Name])
+		facet := Facet{Name: bs.Name, Type: FacetTypeBoolSelect}
+		// bleve индексирует булевы значения терминами "T" и "F"
+		for _, v := range []struct {
+			value string
+			term  string
+		}{{"true", "T"}, {"false", "F"}} {
+			facet.Values = append(facet.Values, FacetValue{
+				Value:    v.value,
+				Count:    counts[strings.ToLower(v.term)],
+				Selected: chosen[bs.Name][v.value],
+			})
+		}
+		facets = append(facets, facet)
+	}
+
+	return facets, nil
+}
+
+// facetConfig возвращает фильтры категории из запроса или объединение фильтров всех категорий
+func (fc *FilterClient) facetConfig(filters *request.FilterRequest) config.FilterConfig {
+	if filters != nil && filters.Category != "" {
+		f, _ := fc.GetByCategory(filters.Category)
+		return f
+	}
+
+	merged := config.FilterConfig{}
+	seen := make(map[string]bool)
+	multiSelect := make(map[string]int)
+	oneSelect := make(map[string]int)
+	for _, f := range fc.FiltersConfig {
+		for _, r := range f.Range {
+			if !seen[r.Name] {
+				seen[r.Name] = true
+				merged.Range = append(merged.Range, r)
+			}
+		}
+		for _, ms := range f.MultiSelect {
+			if i, ok := multiSelect[ms.Name]; ok {
+				merged.MultiSelect[i].Value = mergeValues(merged.MultiSelect[i].Value, ms.Value)
+				continue
+			}
+			if !seen[ms.Name] {
+				seen[ms.Name] = true
+				multiSelect[ms.Name] = len(merged.MultiSelect)
+				merged.MultiSelect = append(merged.MultiSelect, config.MultiSelectFilter{Name: ms.Name, Value: mergeValues(nil, ms.Value)})
+			}
+		}
+		for _, os := range f.OneSelect {
+			if i, ok := oneSelect[os.Name]; ok {
+				merged.OneSelect[i].Value = mergeValues(merged.OneSelect[i].Value, os.Value)
+				continue
+			}
+			if !seen[os.Name] {
+				seen[os.Name] = true
+				oneSelect[os.Name] = len(merged.OneSelect)
+				merged.OneSelect = append(merged.OneSelect, config.OneSelectFilter{Name: os.Name, Value: mergeValues(nil, os.Value)})
+			}
+		}
+		for _, bs := range f.BoolSelect {
+			if !seen[bs.Name] {
+				seen[bs.Name] = true
+				merged.BoolSelect = append(merged.BoolSelect, bs)
+			}
+		}
+	}
+	return merged
+}
+
+func mergeValues(dst, src []string) []string {
+	for _, v := range src {
+		found := false
+		for _, d := range dst {
+			if strings.EqualFold(d, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			dst = append(dst, v)
+		}
+	}
+	return dst
+}
+
+func termsFacet(name, facetType string, values []string, res *search.FacetResult, chosen map[string]bool) Facet {
+	counts := termCounts(res)
+	facet := Facet{Name: name, Type: facetType, Values: make([]FacetValue, 0, len(values))}
+	for _, v := range values {
+		facet.Values = append(facet.Values, FacetValue{
+			Value:    v,
+			Count:    counts[strings.ToLower(v)],
+			Selected: chosen[strings.ToLower(v)],
+		})
+	}
+	return facet
+}
+
+func termCounts(res *search.FacetResult) map[string]int {
+	counts := make(map[string]int)
+	if res == nil {
+		return counts
+	}
+	for _, t := range res.Terms.Terms() {
+		counts[strings.ToLower(t.Term)] = t.Count
+	}
+	return counts
+}
+
+// selectedFilters - имена фильтров, выбранных в запросе (кроме категории)
+func selectedFilters(filters *request.FilterRequest) map[string]bool {
+	selected := make(map[string]bool)
+	if filters == nil {
+		return selected
+	}
+	for _, r := range filters.Range {
+		selected[r.Name] = true
+	}
+	if filters.Price != nil {
+		selected[filters.Price.Name] = true
+	}
+	for _, ms := range filters.MultiSelect {
+		selected[ms.Name] = true
+	}
+	for _, os := range filters.OneSelect {
+		selected[os.Name] = true
+	}
+	for _, bs := range filters.BoolSelect {
+		selected[bs.Name] = true
+	}
+	return selected
+}
+
+// selectedValues - выбранные значения фильтров в нижнем регистре, по имени фильтра
+func selectedValues(filters *request.FilterRequest) map[string]map[string]bool {
+	chosen := make(map[string]map[string]bool)
+	if filters == nil {
+		return chosen
+	}
+	mark := func(name, value string) {
+		if chosen[name] == nil {
+			chosen[name] = make(map[string]bool)
+		}
+		chosen[name][strings.ToLower(value)] = true
+	}
+	for _, ms := range filters.MultiSelect {
+		for _, v := range ms.Value {
+			mark(ms.Name, v)
+		}
+	}
+	for _, os := range filters.OneSelect {
+		mark(os.Name, os.Value)
+	}
+	for _, bs := range filters.BoolSelect {
+		mark(bs.Name, strconv.FormatBool(bs.Value))
+	}
+	return chosen
+}
+
+// withoutFilter возвращает копию фильтров запроса без фильтра name
+func withoutFilter(filters *request.FilterRequest, name string) *request.FilterRequest {
+	res := &request.FilterRequest{Category: filters.Category}
+	for _, r := range filters.Range {
+		if r.Name != name {
+			res.Range = append(res.Range, r)
+		}
+	}
+	if filters.Price != nil && filters.Price.Name != name {
+		res.Price = filters.Price
+	}
+	for _, ms := range filters.MultiSelect {
+		if ms.Name != name {
+			res.MultiSelect = append(res.MultiSelect, ms)
+		}
+	}
+	for _, os := range filters.OneSelect {
+		if os.Name != name {
+			res.OneSelect = append(res.OneSelect, os)
+		}
+	}
+	for _, bs := range filters.BoolSelect {
+		if bs.Name != name {
+			res.BoolSelect = append(res.BoolSelect, bs)
+		}
+	}
+	return res
+}
+
+// numericBuckets делит диапазон из конфига на равные интервалы.
+// Крайние интервалы открыты, чтобы учесть документы за границами конфига.
+func numericBuckets(r config.RangeFilter) ([]numericBucket, error) {
+	from := parseNumeric(r.FromValue)
+	if from == nil {
+		return nil, fmt.Errorf("invalid min value: %s", r.FromValue)
+	}
+	to := parseNumeric(r.ToValue)
+	if to == nil {
+		return nil, fmt.Errorf("invalid max value: %s", r.ToValue)
+	}
+
+	n := numericBucketCount
+	if *to <= *from {
+		n = 1
+	}
+	step := (*to - *from) / float64(n)
+
+	buckets := make([]numericBucket, 0, n)
+	for i := 0; i < n; i++ {
+		b := numericBucket{}
+		if i > 0 {
+			lo := *from + step*float64(i)
+			b.min = &lo
+			b.From = formatNumber(lo)
+		}
+		if i < n-1 {
+			hi := *from + step*float64(i+1)
+			b.max = &hi
+			b.To = formatNumber(hi)
+		}
+		b.Name = fmt.Sprintf("%s-%s", b.From, b.To)
+		buckets = append(buckets, b)
+	}
+	return buckets, nil
+}
+
+// dateBuckets строит гистограмму по диапазону дат из конфига:
+// по годам, если диапазон длиннее двух лет, иначе по месяцам
+func (fc *FilterClient) dateBuckets(r config.RangeFilter) ([]dateBucket, error) {
+	from, err := fc.parseFacetDate(r.FromValue)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from date: %s", r.FromValue)
+	}
+	to, err := fc.parseFacetDate(r.ToValue)
+	if err != nil {
+		return nil, fmt.Errorf("invalid to date: %s", r.ToValue)
+	}
+
+	yearly := to.Sub(from) > 2*365*24*time.Hour
+	var start time.Time
+	if yearly {
+		start = time.Date(from.Year(), 1, 1, 0, 0, 0, 0, from.Location())
+	} else {
+		start = time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, from.Location())
+	}
+
+	buckets := make([]dateBucket, 0)
+	for !start.After(to) {
+		var end time.Time
+		if yearly {
+			end = start.AddDate(1, 0, 0)
+		} else {
+			end = start.AddDate(0, 1, 0)
+		}
+		b := dateBucket{start: start, end: end}
+		b.From = start.Format(time.RFC3339)
+		b.To = end.Format(time.RFC3339)
+		if yearly {
+			b.Name = start.Format("2006")
+		} else {
+			b.Name = start.Format("2006-01")
+		}
+		buckets = append(buckets, b)
+		start = end
+	}
+	return buckets, nil
+}
+
+// parseFacetDate разбирает границу диапазона дат из конфига фильтров
+func (fc *FilterClient) parseFacetDate(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, nil
+	}
+	t, err = fc.ParseDate(value)
+	if err == nil {
+		return t, nil
+	}
+	// конфиг может хранить дату с временем, берем только дату
+	if len(value) > len("2006-01-02") {
+		return time.Parse("2006-01-02", value[:len("2006-01-02")])
+	}
+	return time.Time{}, err
+}
+
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
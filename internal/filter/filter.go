@@ -45,7 +45,7 @@ func (fc *FilterClient) ApplyFilters(filters *request.FilterRequest) (query.Quer
 		return nil, nil
 	}
 	if len(filters.Range) == 0 && len(filters.MultiSelect) == 0 && len(filters.OneSelect) == 0 &&
-		len(filters.BoolSelect) == 0 && len(filters.Category) == 0 {
+		len(filters.BoolSelect) == 0 && len(filters.Category) == 0 && filters.Price == nil {
 		return nil, nil
 	}
 
@@ -83,6 +83,15 @@ func (fc *FilterClient) ApplyFilters(filters *request.FilterRequest) (query.Quer
 		combinedFilter.AddMust(rangeQueries)
 	}
 
+	// цена из текста запроса сужает выдачу вместе с range, а не добавляется к ним через ИЛИ
+	if filters.Price != nil {
+		q, err := fc.buildNumericRangeQuery(*filters.Price)
+		if err != nil {
+			return nil, fmt.Errorf("price filter error (%s): %v", filters.Price.Name, err)
+		}
+		combinedFilter.AddMust(q)
+	}
+
 	if len(filters.MultiSelect) != 0 {
 		// multi-select filters
 		msFilters := make([]query.Query, 0, len(filters.MultiSelect))
@@ -150,20 +159,29 @@ func (fc *FilterClient) buildDateRangeQuery(r config.RangeFilter) (query.Query,
 	return dateQuery, nil
 }
 
+// buildNumericRangeQuery строит числовой диапазон; пустая граница - диапазон открыт с этой стороны ("до 5000")
 func (fc *FilterClient) buildNumericRangeQuery(r config.RangeFilter) (query.Query, error) {
-	// Для числовых значений оставляем указатели
-	min, err := strconv.ParseFloat(r.FromValue, 64)
-	if err != nil {
-		return nil, fmt.Errorf("invalid min value: %s", r.FromValue)
+	if r.FromValue == "" && r.ToValue == "" {
+		return nil, fmt.Errorf("range bounds are empty")
 	}
 
-	max, err := strconv.ParseFloat(r.ToValue, 64)
-	if err != nil {
-		return nil, fmt.Errorf("invalid max value: %s", r.ToValue)
+	// Для числовых значений оставляем указатели
+	var min, max *float64
+	if r.FromValue != "" {
+		min = parseNumeric(r.FromValue)
+		if min == nil {
+			return nil, fmt.Errorf("invalid min value: %s", r.FromValue)
+		}
+	}
+	if r.ToValue != "" {
+		max = parseNumeric(r.ToValue)
+		if max == nil {
+			return nil, fmt.Errorf("invalid max value: %s", r.ToValue)
+		}
 	}
 
 	// Для числовых диапазонов передаем указатели
-	numQuery := bleve.NewNumericRangeQuery(&min, &max)
+	numQuery := bleve.NewNumericRangeQuery(min, max)
 	numQuery.SetField(r.Name)
 	return numQuery, nil
 }
@@ -177,8 +195,8 @@ func parseNumeric(value string) *float64 {
 	return &val
 }
 
-// parseDate преобразует строку в time.Time
-func (fc *FilterClient) parseDate(dateStr string) (time.Time, error) {
+// ParseDate преобразует строку в time.Time по DATE_LAYOUT
+func (fc *FilterClient) ParseDate(dateStr string) (time.Time, error) {
 	layout := fc.cfg.DateLayout
 	return time.Parse(layout, dateStr)
 }
@@ -0,0 +1,87 @@
+package index
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search"
+	"strconv"
+)
+
+// ErrInvalidCursor - курсор не декодируется или получен для другой сортировки
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursor - позиция в выдаче для постраничного обхода через search_after.
+// Хранит сортировку, для которой он получен, чтобы не применить его к другому запросу.
+type cursor struct {
+	Sort  []string `json:"s"`
+	After []string `json:"a"`
+}
+
+// EncodeCursor возвращает непрозрачный курсор, указывающий на позицию после hit
+func EncodeCursor(sortOrder search.SortOrder, hit *search.DocumentMatch) (string, error) {
+	sortSpec, err := sortSpec(sortOrder)
+	if err != nil {
+		return "", err
+	}
+
+	after := make([]string, len(hit.Sort))
+	copy(after, hit.Sort)
+	// для сортировки по релевантности bleve кладет в Sort "_score", а сравнивает по самому score
+	for i, so := range sortOrder {
+		if so.RequiresScoring() && i < len(after) {
+			after[i] = strconv.FormatFloat(hit.Score, 'g', -1, 64)
+		}
+	}
+
+	data, err := json.Marshal(cursor{Sort: sortSpec, After: after})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// ApplyCursor проставляет в запрос search_after из курсора
+func ApplyCursor(req *bleve.SearchRequest, encoded string) error {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+
+	var c cursor
+	err = json.Unmarshal(data, &c)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+
+	reqSpec, err := sortSpec(req.Sort)
+	if err != nil {
+		return err
+	}
+	if len(reqSpec) != len(c.Sort) || len(c.After) != len(c.Sort) {
+		return fmt.Errorf("%w: sort does not match", ErrInvalidCursor)
+	}
+	for i := range reqSpec {
+		if reqSpec[i] != c.Sort[i] {
+			return fmt.Errorf("%w: sort does not match", ErrInvalidCursor)
+		}
+	}
+
+	req.From = 0
+	req.SetSearchAfter(c.After)
+	return nil
+}
+
+func sortSpec(sortOrder search.SortOrder) ([]string, error) {
+	spec := make([]string, 0, len(sortOrder))
+	for _, so := range sortOrder {
+		data, err := json.Marshal(so)
+		if err != nil {
+			return nil, err
+		}
+		spec = append(spec, string(data))
+	}
+	return spec, nil
+}
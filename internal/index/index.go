@@ -1,9 +1,12 @@
 package index
 
 import (
+	"context"
 	"fmt"
 	"github.com/blevesearch/bleve/v2"
 	mapping2 "github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/query"
 	index "github.com/blevesearch/bleve_index_api"
 	"log"
 	"os"
@@ -13,6 +16,13 @@ import (
 	"sync"
 )
 
+const (
+	synonymDocPrefix = "_synonym_"
+
+	// walkPageSize - размер страницы при внутреннем обходе всех документов
+	walkPageSize = 10000
+)
+
 type Index struct {
 	cfg *config.Config
 
@@ -32,39 +42,24 @@ func New(cfg *config.Config) *Index {
 	if err != nil {
 		log.Println("[INDEX][ERROR] error while opening:", err)
 
-		indexMapping := bleve.NewIndexMapping()
-		docMapping := bleve.NewDocumentMapping()
-
-		// Создаем поля на основе конфигурации
-		for _, field := range cfg.IndexCfg.Fields {
-			var fieldMapping *mapping2.FieldMapping
-
-			if field.Type == "timestamp" {
-				fieldMapping = bleve.NewDateTimeFieldMapping()
-			} else {
-				fieldMapping = bleve.NewTextFieldMapping()
-			}
-			//fieldMapping := bleve.NewTextFieldMapping()
-
-			fieldMapping.Index = field.Searchable
-
-			if field.Filterable {
-				fieldMapping.Store = true
-			}
-
-			if field.Sortable {
-				fieldMapping.DocValues = true
-			}
-
-			docMapping.AddFieldMappingsAt(field.Name, fieldMapping)
+		indexMapping, err := BuildMapping(cfg.IndexCfg)
+		if err != nil {
+			log.Fatalln("[INDEX][ERROR] error while building mapping:", err)
 		}
 
-		indexMapping.AddDocumentMapping("document", docMapping)
-
 		bleveIndex, err = bleve.New(fmt.Sprintf("%s%s", cfg.IndexPath, cfg.IndexCfg.IndexName), indexMapping)
 		if err != nil {
 			log.Fatalln("[INDEX][ERROR] error while creating:", err)
 		}
+
+		if indexMapping.SynonymCount() > 0 {
+			for _, rule := range cfg.SynonymCfg {
+				err = indexSynonym(bleveIndex, rule)
+				if err != nil {
+					log.Println("[INDEX][ERROR] error while indexing synonyms:", err)
+				}
+			}
+		}
 	}
 
 	return &Index{
@@ -118,7 +113,7 @@ func (i *Index) Update(docID string, document map[string]interface{}) error {
 
 	err = i.Delete(docID)
 	if err != nil {
-		log.Printf("[INDEX][ERROR] error while deleting docID: '%s' err:\n", docID, err)
+		log.Printf("[INDEX][ERROR] error while deleting docID: '%s' err: %v\n", docID, err)
 	}
 	// Добавляем документ в индекс
 	i.mu.Lock()
@@ -132,148 +127,194 @@ func (i *Index) Update(docID string, document map[string]interface{}) error {
 	return nil
 }
 
+// Search выполняет запрос по пользовательским документам: правила синонимов исключаются из hits, total и фасетов
 func (i *Index) Search(req *bleve.SearchRequest) (*bleve.SearchResult, error) {
-	return i.bIndex.Search(req)
+	r := *req
+	r.Query = ExcludeSynonyms(req.Query)
+	return i.bIndex.Search(&r)
+}
+
+// ExcludeSynonyms дополняет запрос исключением документов правил синонимов:
+// bleve хранит словарь синонимов в том же индексе, и match_all или запрос из одних исключений их находит
+func ExcludeSynonyms(q query.Query) query.Query {
+	synonyms := bleve.NewPrefixQuery(synonymDocPrefix)
+	synonyms.SetField("_id")
+
+	bq := bleve.NewBooleanQuery()
+	bq.AddMust(q)
+	bq.AddMustNot(synonyms)
+	return bq
 }
 
 func (i *Index) GetDocId(id string) (index.Document, error) {
+	if isSynonymDoc(id) {
+		return nil, nil
+	}
 	return i.bIndex.Document(id)
 }
 
 func (i *Index) GetAllDoc() ([]map[string]interface{}, error) {
-	// Создаем запрос, который соответствует всем документам
-	query := bleve.NewMatchAllQuery()
+	var results []map[string]interface{}
 
-	// Настраиваем параметры поиска
-	searchRequest := bleve.NewSearchRequest(query)
-	searchRequest.Size = 10000           // Максимальное количество документов на странице
-	searchRequest.Fields = []string{"*"} // Запрашиваем все поля
+	err := walkDocuments(i.bIndex, walkPageSize, func(hit *search.DocumentMatch) error {
+		results = append(results, hit.Fields)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	var results []map[string]interface{}
+	return results, nil
+}
 
-	for {
-		// Выполняем поиск
-		searchResult, err := i.bIndex.Search(searchRequest)
+// GetDocsPage возвращает страницу документов после курсора и курсор следующей страницы.
+// Пустой курсор следующей страницы - документы закончились.
+func (i *Index) GetDocsPage(cursorStr string, size int) ([]map[string]interface{}, string, error) {
+	searchRequest := newWalkRequest(size)
+	if cursorStr != "" {
+		err := ApplyCursor(searchRequest, cursorStr)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
+	}
 
-		// Собираем результаты
-		for _, hit := range searchResult.Hits {
-			results = append(results, hit.Fields)
-		}
+	res, err := i.bIndex.Search(searchRequest)
+	if err != nil {
+		return nil, "", err
+	}
 
-		// Проверяем, есть ли еще документы
-		if searchResult.Total <= uint64(searchRequest.From+searchRequest.Size) {
-			break
-		}
-		searchRequest.From += searchRequest.Size
+	results := make([]map[string]interface{}, 0, len(res.Hits))
+	for _, hit := range res.Hits {
+		results = append(results, map[string]interface{}{
+			"id":     hit.ID,
+			"fields": hit.Fields,
+		})
 	}
 
-	return results, nil
+	next := ""
+	if len(res.Hits) == size {
+		next, err = EncodeCursor(searchRequest.Sort, res.Hits[len(res.Hits)-1])
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	return results, next, nil
 }
 
-func (i *Index) ReindexBleve() error {
-	tmpIndexPath := fmt.Sprintf("%s%s", i.cfg.IndexPath, i.cfg.IndexCfg.IndexName) + "_tmp"
-	_ = os.RemoveAll(tmpIndexPath)
-
-	oldIndex := i.bIndex
-	oldMappingIface := oldIndex.Mapping()
-	oldMapping, ok := oldMappingIface.(*mapping2.IndexMappingImpl)
-	if !ok {
-		return fmt.Errorf("failed to cast index mapping to IndexMappingImpl")
+// Dictionary возвращает термины поля с количеством документов, в которых они встречаются
+func (i *Index) Dictionary(field string) (map[string]uint64, error) {
+	dict, err := i.bIndex.FieldDict(field)
+	if err != nil {
+		return nil, err
 	}
+	defer dict.Close()
 
-	// Копируем маппинг, чтобы не мутировать существующий
-	newMapping := *oldMapping
+	terms := make(map[string]uint64)
+	entry, err := dict.Next()
+	for err == nil && entry != nil {
+		terms[entry.Term] = entry.Count
+		entry, err = dict.Next()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return terms, nil
+}
 
-	synonymCollection := "my_synonym_collection"
-	synonymSourceName := "my_synonyms"
+// TermStat - термин значения поля: частота в значении и количество документов индекса с термином
+type TermStat struct {
+	Term    string
+	Freq    int
+	DocFreq uint64
+}
 
-	// Добавляем synonym source в новый маппинг ДО создания индекса
-	err := newMapping.AddSynonymSource(synonymSourceName, map[string]interface{}{
-		"collection": synonymCollection,
-	})
-	if err != nil && !strings.Contains(err.Error(), "already defined") {
-		return fmt.Errorf("AddSynonymSource() failed: %v", err)
+// TermStats разбирает значение поля анализатором поля и возвращает статистику его терминов по индексу
+// и количество пользовательских документов в индексе
+func (i *Index) TermStats(field string, value string) ([]TermStat, uint64, error) {
+	indexMapping := i.bIndex.Mapping()
+	analyzer := indexMapping.AnalyzerNamed(indexMapping.AnalyzerNameForPath(field))
+	if analyzer == nil {
+		return nil, 0, fmt.Errorf("no analyzer for field %s", field)
 	}
 
-	// Привязываем SynonymSource к полям по умолчанию
-	for _, field := range newMapping.DefaultMapping.Fields {
-		field.SynonymSource = synonymSourceName
+	freqs := make(map[string]int)
+	var terms []string
+	for _, token := range analyzer.Analyze([]byte(value)) {
+		term := string(token.Term)
+		if freqs[term] == 0 {
+			terms = append(terms, term)
+		}
+		freqs[term]++
+	}
+	if len(terms) == 0 {
+		return nil, 0, nil
 	}
 
-	// Создаём новый индекс
-	newIndex, err := bleve.New(tmpIndexPath, &newMapping)
+	// документы считаются через Search: правила синонимов лежат в том же индексе и исказили бы idf
+	all, err := i.Search(bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), 0, 0, false))
 	if err != nil {
-		return fmt.Errorf("failed to create new index with updated mapping: %w", err)
+		return nil, 0, err
 	}
 
-	// Добавляем синонимы в индекс
-	synDef := &bleve.SynonymDefinition{
-		Synonyms: []string{"кепка", "шапка", "бейсболка", "панама"},
+	advanced, err := i.bIndex.Advanced()
+	if err != nil {
+		return nil, 0, err
 	}
+	reader, err := advanced.Reader()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer reader.Close()
 
-	if synIndex, ok := newIndex.(bleve.SynonymIndex); ok {
-		err = synIndex.IndexSynonym("synDoc1", synonymCollection, synDef)
+	stats := make([]TermStat, 0, len(terms))
+	for _, term := range terms {
+		tfr, err := reader.TermFieldReader(context.Background(), []byte(term), field, false, false, false)
 		if err != nil {
-			return fmt.Errorf("failed to index synonym: %w", err)
+			return nil, 0, err
 		}
-	} else {
-		return fmt.Errorf("index does not support synonym indexing")
+		stats = append(stats, TermStat{Term: term, Freq: freqs[term], DocFreq: tfr.Count()})
+		tfr.Close()
 	}
+	return stats, all.Total, nil
+}
 
-	// Переносим документы из старого индекса
-	query := bleve.NewMatchAllQuery()
-	searchRequest := bleve.NewSearchRequest(query)
-	sessionSize := 10000
-	searchRequest.Size = sessionSize
+// newWalkRequest - запрос всех пользовательских документов в стабильном порядке по _id для обхода через search_after
+func newWalkRequest(size int) *bleve.SearchRequest {
+	searchRequest := bleve.NewSearchRequestOptions(ExcludeSynonyms(bleve.NewMatchAllQuery()), size, 0, false)
 	searchRequest.Fields = []string{"*"}
-	searchRequest.From = 0
-	count := 0
+	searchRequest.SortBy([]string{"_id"})
+	return searchRequest
+}
+
+// walkDocuments обходит все документы индекса страницами через search_after.
+// В отличие от смещения (From) не пропускает и не дублирует документы при параллельной записи.
+func walkDocuments(bIndex bleve.Index, pageSize int, fn func(hit *search.DocumentMatch) error) error {
+	searchRequest := newWalkRequest(pageSize)
 	for {
-		res, err := oldIndex.Search(searchRequest)
+		res, err := bIndex.Search(searchRequest)
 		if err != nil {
 			return fmt.Errorf("search error: %w", err)
 		}
-		if len(res.Hits) == 0 {
-			break
-		}
+
 		for _, hit := range res.Hits {
-			id := hit.ID
-			doc := hit.Fields
-			err = newIndex.Index(id, doc)
+			err = fn(hit)
 			if err != nil {
-				log.Printf("failed to reindex doc %s: %v", id, err)
-				continue
-			}
-			count++
-			if count%1000 == 0 {
-				log.Printf("Reindexed %d documents...", count)
+				return err
 			}
 		}
-		searchRequest.From += sessionSize
-	}
 
-	err = newIndex.Close()
-	if err != nil {
-		return fmt.Errorf("failed to close new index: %w", err)
-	}
-	err = oldIndex.Close()
-	if err != nil {
-		return fmt.Errorf("failed to close old index: %w", err)
-	}
-	err = os.RemoveAll(fmt.Sprintf("%s%s", i.cfg.IndexPath, i.cfg.IndexCfg.IndexName))
-	if err != nil {
-		return fmt.Errorf("failed to delete old index: %w", err)
-	}
-	err = os.Rename(tmpIndexPath, fmt.Sprintf("%s%s", i.cfg.IndexPath, i.cfg.IndexCfg.IndexName))
-	if err != nil {
-		return fmt.Errorf("failed to rename new index: %w", err)
+		if len(res.Hits) < pageSize {
+			return nil
+		}
+		searchRequest.SetSearchAfter(res.Hits[len(res.Hits)-1].Sort)
 	}
-	i.bIndex, err = bleve.Open(fmt.Sprintf("%s%s", i.cfg.IndexPath, i.cfg.IndexCfg.IndexName))
+}
+
+// ReindexBleve пересоздает индекс по текущему маппингу и заново индексирует словарь синонимов
+func (i *Index) ReindexBleve() error {
+	count, err := i.recreate(i.ICfg)
 	if err != nil {
-		return fmt.Errorf("failed to reopen new index: %w", err)
+		return err
 	}
 
 	log.Printf("Reindexing complete. Total documents reindexed: %d", count)
@@ -281,106 +322,139 @@ func (i *Index) ReindexBleve() error {
 }
 
 func (i *Index) RebuildIndex() error {
+	count, err := i.recreate(i.cfg.IndexCfg)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Reindexing complete. Total documents reindexed: %d\n", count)
+	log.Printf("Complete rebuilding index\n")
+	i.ICfg = i.cfg.IndexCfg
+	i.isBuilded = true
+	return nil
+}
+
+// recreate создает новый индекс по конфигурации, переносит в него документы и синонимы
+// и подменяет им текущий индекс. Возвращает количество перенесенных документов.
+func (i *Index) recreate(icfg *config.IndexConfig) (int, error) {
 	tmpIndexPath := fmt.Sprintf("%s%s", i.cfg.IndexPath, i.cfg.IndexCfg.IndexName) + "_tmp"
 	_ = os.RemoveAll(tmpIndexPath)
 
 	oldIndex := i.bIndex
 
 	// Создаём новый индекс
-	indexMapping := bleve.NewIndexMapping()
-	docMapping := bleve.NewDocumentMapping()
-
-	// Создаем поля на основе конфигурации
-	for _, field := range i.cfg.IndexCfg.Fields {
-		var fieldMapping *mapping2.FieldMapping
-
-		if field.Type == "timestamp" {
-			fieldMapping = bleve.NewDateTimeFieldMapping()
-		} else {
-			fieldMapping = bleve.NewTextFieldMapping()
-		}
-		//fieldMapping := bleve.NewTextFieldMapping()
-
-		fieldMapping.Index = field.Searchable
-
-		if field.Filterable {
-			fieldMapping.Store = true
-		}
-
-		if field.Sortable {
-			fieldMapping.DocValues = true
-		}
-
-		docMapping.AddFieldMappingsAt(field.Name, fieldMapping)
+	indexMapping, err := BuildMapping(icfg)
+	if err != nil {
+		return 0, fmt.Errorf("failed to build index mapping: %w", err)
 	}
 
-	indexMapping.AddDocumentMapping("document", docMapping)
-
 	newIndex, err := bleve.New(tmpIndexPath, indexMapping)
 	if err != nil {
-		log.Fatalln("[INDEX][ERROR] error while creating:", err)
+		return 0, fmt.Errorf("failed to create new index: %w", err)
 	}
 
 	// Переносим документы из старого индекса
-	query := bleve.NewMatchAllQuery()
-	searchRequest := bleve.NewSearchRequest(query)
-	sessionSize := 10000
-	searchRequest.Size = sessionSize
-	searchRequest.Fields = []string{"*"}
-	searchRequest.From = 0
 	count := 0
-	for {
-		res, err := oldIndex.Search(searchRequest)
+	err = walkDocuments(oldIndex, walkPageSize, func(hit *search.DocumentMatch) error {
+		err := newIndex.Index(hit.ID, hit.Fields)
 		if err != nil {
-			return fmt.Errorf("search error: %w", err)
+			log.Printf("failed to reindex doc %s: %v", hit.ID, err)
+			return nil
 		}
-		if len(res.Hits) == 0 {
-			break
+		count++
+		if count%1000 == 0 {
+			log.Printf("Reindexed %d documents...", count)
 		}
-		for _, hit := range res.Hits {
-			id := hit.ID
-			doc := hit.Fields
-			err = newIndex.Index(id, doc)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// Синонимы не переносятся поиском, индексируем их из словаря
+	if indexMapping.SynonymCount() > 0 {
+		for _, rule := range i.cfg.SynonymCfg {
+			err = indexSynonym(newIndex, rule)
 			if err != nil {
-				log.Printf("failed to reindex doc %s: %v", id, err)
-				continue
-			}
-			count++
-			if count%1000 == 0 {
-				log.Printf("Reindexed %d documents...", count)
+				return 0, err
 			}
 		}
-		searchRequest.From += sessionSize
 	}
 
 	err = newIndex.Close()
 	if err != nil {
-		return fmt.Errorf("failed to close new index: %w", err)
+		return 0, fmt.Errorf("failed to close new index: %w", err)
 	}
 	err = oldIndex.Close()
 	if err != nil {
-		return fmt.Errorf("failed to close old index: %w", err)
+		return 0, fmt.Errorf("failed to close old index: %w", err)
 	}
 	err = os.RemoveAll(fmt.Sprintf("%s%s", i.cfg.IndexPath, i.cfg.IndexCfg.IndexName))
 	if err != nil {
-		return fmt.Errorf("failed to delete old index: %w", err)
+		return 0, fmt.Errorf("failed to delete old index: %w", err)
 	}
 	err = os.Rename(tmpIndexPath, fmt.Sprintf("%s%s", i.cfg.IndexPath, i.cfg.IndexCfg.IndexName))
 	if err != nil {
-		return fmt.Errorf("failed to rename new index: %w", err)
+		return 0, fmt.Errorf("failed to rename new index: %w", err)
 	}
 	i.bIndex, err = bleve.Open(fmt.Sprintf("%s%s", i.cfg.IndexPath, i.cfg.IndexCfg.IndexName))
 	if err != nil {
-		return fmt.Errorf("failed to reopen new index: %w", err)
+		return 0, fmt.Errorf("failed to reopen new index: %w", err)
 	}
 
-	log.Printf("Reindexing complete. Total documents reindexed: %d\n", count)
-	log.Printf("Complete rebuilding index\n")
-	i.ICfg = i.cfg.IndexCfg
-	i.isBuilded = true
+	return count, nil
+}
+
+// SupportsSynonyms сообщает, есть ли в маппинге текущего индекса источники синонимов.
+// Если нет - синонимы применятся только после пересборки индекса.
+func (i *Index) SupportsSynonyms() bool {
+	m, ok := i.bIndex.Mapping().(*mapping2.IndexMappingImpl)
+	return ok && m.SynonymCount() > 0
+}
+
+// IndexSynonym добавляет или обновляет правило синонимов без переиндексации документов
+func (i *Index) IndexSynonym(rule config.SynonymRule) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return indexSynonym(i.bIndex, rule)
+}
+
+// DeleteSynonym удаляет правило синонимов из индекса
+func (i *Index) DeleteSynonym(ruleID string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.bIndex.Delete(synonymDocID(ruleID))
+}
+
+func indexSynonym(bIndex bleve.Index, rule config.SynonymRule) error {
+	synIndex, ok := bIndex.(bleve.SynonymIndex)
+	if !ok {
+		return fmt.Errorf("index does not support synonym indexing")
+	}
+
+	synDef := &bleve.SynonymDefinition{
+		Input:    rule.Input,
+		Synonyms: rule.Synonyms,
+	}
+	err := synIndex.IndexSynonym(synonymDocID(rule.ID), SynonymCollection, synDef)
+	if err != nil {
+		return fmt.Errorf("failed to index synonym '%s': %w", rule.ID, err)
+	}
 	return nil
 }
 
+// synonymDocID - id документа правила синонимов, отделяет их от id обычных документов
+func synonymDocID(ruleID string) string {
+	return synonymDocPrefix + ruleID
+}
+
+// isSynonymDoc сообщает, что документ - правило синонимов, а не пользовательский документ
+func isSynonymDoc(docID string) bool {
+	return strings.HasPrefix(docID, synonymDocPrefix)
+}
+
 func (i *Index) SetNeedRebuild() {
 	i.isBuilded = false
 }
@@ -0,0 +1,231 @@
+package index
+
+import (
+	"fmt"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/custom"
+	_ "github.com/blevesearch/bleve/v2/analysis/analyzer/keyword"
+	_ "github.com/blevesearch/bleve/v2/analysis/analyzer/simple"
+	_ "github.com/blevesearch/bleve/v2/analysis/analyzer/standard"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/en"
+	_ "github.com/blevesearch/bleve/v2/analysis/lang/ru"
+	"github.com/blevesearch/bleve/v2/analysis/token/edgengram"
+	"github.com/blevesearch/bleve/v2/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/v2/analysis/tokenizer/single"
+	"github.com/blevesearch/bleve/v2/analysis/tokenizer/unicode"
+	mapping2 "github.com/blevesearch/bleve/v2/mapping"
+	"searchengine/internal/config"
+)
+
+const (
+	// documentType - тип документа, под которым регистрируется маппинг полей из конфига
+	documentType = "document"
+
+	// categoryField - служебное поле категории документа, по нему работает фильтр категорий
+	categoryField = "category"
+
+	// KeywordAnalyzer - точное совпадение значения целиком, без токенизации, в нижнем регистре
+	KeywordAnalyzer = "keyword_lowercase"
+
+	// SynonymCollection - коллекция bleve, в которую индексируется словарь синонимов
+	SynonymCollection = "synonyms"
+
+	// SuggestAnalyzer - префиксы слов (edge n-gram) в нижнем регистре для автодополнения
+	SuggestAnalyzer    = "suggest_edge_ngram"
+	suggestTokenFilter = "suggest_edge_ngram_filter"
+
+	// SuggestMaxPrefix - максимальная длина индексируемого префикса слова
+	SuggestMaxPrefix = 20
+
+	// SpellField - служебное поле со словами всех searchable полей без стемминга, словарь для исправления опечаток
+	SpellField    = "spell"
+	spellAnalyzer = "spell_words"
+)
+
+// SuggestField - подполе с префиксами слов значения поля, по нему ищутся подсказки
+func SuggestField(field string) string {
+	return field + "_suggest"
+}
+
+// SuggestRawField - подполе с исходным значением поля целиком, по нему считаются подсказки
+func SuggestRawField(field string) string {
+	return field + "_suggest_raw"
+}
+
+// BuildMapping строит маппинг bleve по конфигурации индекса.
+// Используется и при создании индекса, и при его перестроении.
+func BuildMapping(icfg *config.IndexConfig) (*mapping2.IndexMappingImpl, error) {
+	indexMapping := bleve.NewIndexMapping()
+
+	err := indexMapping.AddCustomAnalyzer(KeywordAnalyzer, map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     single.Name,
+		"token_filters": []string{lowercase.Name},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add keyword analyzer: %w", err)
+	}
+
+	err = indexMapping.AddCustomTokenFilter(suggestTokenFilter, map[string]interface{}{
+		"type": edgengram.Name,
+		"min":  1.0,
+		"max":  float64(SuggestMaxPrefix),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add suggest token filter: %w", err)
+	}
+	err = indexMapping.AddCustomAnalyzer(SuggestAnalyzer, map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     unicode.Name,
+		"token_filters": []string{lowercase.Name, suggestTokenFilter},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add suggest analyzer: %w", err)
+	}
+
+	err = indexMapping.AddCustomAnalyzer(spellAnalyzer, map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     unicode.Name,
+		"token_filters": []string{lowercase.Name},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add spell analyzer: %w", err)
+	}
+
+	// Пользовательские анализаторы из конфига
+	for name, a := range icfg.Analyzers {
+		err = indexMapping.AddCustomAnalyzer(name, map[string]interface{}{
+			"type":          custom.Name,
+			"char_filters":  a.CharFilters,
+			"tokenizer":     a.Tokenizer,
+			"token_filters": a.TokenFilters,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to add analyzer '%s': %w", name, err)
+		}
+	}
+	indexMapping.DefaultAnalyzer = icfg.IndexAnalyzer()
+
+	docMapping := bleve.NewDocumentMapping()
+
+	// Категория всегда сравнивается целиком (см. filter.ApplyFilters)
+	categoryMapping := newFieldMapping(config.FieldConfig{Name: categoryField, Type: "keyword", Filterable: true})
+	categoryMapping.IncludeInAll = false
+	docMapping.AddFieldMappingsAt(categoryField, categoryMapping)
+
+	// Создаем поля на основе конфигурации
+	for _, field := range icfg.Fields {
+		fieldMapping := newFieldMapping(field)
+		if field.Type == "string" {
+			fieldMapping.Analyzer = icfg.FieldAnalyzer(field)
+		}
+		if field.Synonym && field.Type == "string" {
+			fieldMapping.SynonymSource, err = addSynonymSource(indexMapping, fieldMapping.Analyzer)
+			if err != nil {
+				return nil, err
+			}
+		}
+		docMapping.AddFieldMappingsAt(field.Name, fieldMapping)
+		if field.Suggest {
+			docMapping.AddFieldMappingsAt(field.Name, newSuggestMappings(field)...)
+		}
+		if field.Searchable && (field.Type == "string" || field.Type == "keyword") {
+			docMapping.AddFieldMappingsAt(field.Name, newSpellMapping())
+		}
+	}
+
+	indexMapping.AddDocumentMapping(documentType, docMapping)
+	// Документы приходят без поля "_type", поэтому маппинг полей назначаем типом по умолчанию
+	indexMapping.DefaultType = documentType
+
+	err = indexMapping.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid index mapping: %w", err)
+	}
+
+	return indexMapping, nil
+}
+
+// newFieldMapping создает маппинг одного поля в зависимости от его типа
+func newFieldMapping(field config.FieldConfig) *mapping2.FieldMapping {
+	var fieldMapping *mapping2.FieldMapping
+
+	switch field.Type {
+	case "timestamp":
+		fieldMapping = bleve.NewDateTimeFieldMapping()
+	case "number":
+		fieldMapping = bleve.NewNumericFieldMapping()
+	case "bool":
+		fieldMapping = bleve.NewBooleanFieldMapping()
+	case "keyword":
+		fieldMapping = bleve.NewTextFieldMapping()
+		fieldMapping.Analyzer = KeywordAnalyzer
+	default:
+		fieldMapping = bleve.NewTextFieldMapping()
+	}
+
+	// Поле должно попасть в индекс, если по нему ищут, фильтруют или сортируют
+	fieldMapping.Index = field.Searchable || field.Filterable || field.Sortable
+	// В полнотекстовый поиск (_all) попадают только searchable поля
+	fieldMapping.IncludeInAll = field.Searchable
+	// Значения храним всегда: они нужны в выдаче и при перестроении индекса
+	fieldMapping.Store = true
+	fieldMapping.DocValues = field.Sortable || field.Filterable
+
+	return fieldMapping
+}
+
+// newSuggestMappings создает подполя автодополнения: префиксы слов для поиска
+// и исходное значение целиком для подсчета подсказок
+func newSuggestMappings(field config.FieldConfig) []*mapping2.FieldMapping {
+	prefixMapping := bleve.NewTextFieldMapping()
+	prefixMapping.Name = SuggestField(field.Name)
+	prefixMapping.Analyzer = SuggestAnalyzer
+	prefixMapping.Store = false
+	prefixMapping.IncludeInAll = false
+	prefixMapping.IncludeTermVectors = false
+	prefixMapping.DocValues = false
+
+	rawMapping := bleve.NewKeywordFieldMapping()
+	rawMapping.Name = SuggestRawField(field.Name)
+	rawMapping.Store = false
+	rawMapping.IncludeInAll = false
+	rawMapping.IncludeTermVectors = false
+	rawMapping.DocValues = true
+
+	return []*mapping2.FieldMapping{prefixMapping, rawMapping}
+}
+
+// newSpellMapping создает подполе словаря опечаток. Все searchable поля пишут слова в одно поле SpellField.
+func newSpellMapping() *mapping2.FieldMapping {
+	spellMapping := bleve.NewTextFieldMapping()
+	spellMapping.Name = SpellField
+	spellMapping.Analyzer = spellAnalyzer
+	spellMapping.Store = false
+	spellMapping.IncludeInAll = false
+	spellMapping.IncludeTermVectors = false
+	spellMapping.DocValues = false
+	return spellMapping
+}
+
+// addSynonymSource регистрирует источник синонимов для анализатора поля.
+// Анализатор источника должен совпадать с анализатором поля, поэтому источник заводится на каждый анализатор.
+func addSynonymSource(indexMapping *mapping2.IndexMappingImpl, analyzer string) (string, error) {
+	if analyzer == "" {
+		analyzer = indexMapping.DefaultAnalyzer
+	}
+
+	name := "synonyms_" + analyzer
+	if _, ok := indexMapping.CustomAnalysis.SynonymSources[name]; ok {
+		return name, nil
+	}
+
+	err := indexMapping.AddSynonymSource(name, map[string]interface{}{
+		"collection": SynonymCollection,
+		"analyzer":   analyzer,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to add synonym source '%s': %w", name, err)
+	}
+	return name, nil
+}
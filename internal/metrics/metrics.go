@@ -29,6 +29,35 @@ var (
 		},
 		[]string{"handler", "method"},
 	)
+	experimentRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "search_experiment_requests_total",
+			Help: "Количество поисковых запросов по вариантам A/B экспериментов",
+		},
+		[]string{"experiment", "variant", "handler"},
+	)
+	experimentErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "search_experiment_errors_total",
+			Help: "Количество ошибок поиска по вариантам A/B экспериментов",
+		},
+		[]string{"experiment", "variant", "handler"},
+	)
+	experimentZeroResults = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "search_experiment_zero_results_total",
+			Help: "Количество поисковых запросов без результатов по вариантам A/B экспериментов",
+		},
+		[]string{"experiment", "variant", "handler"},
+	)
+	experimentDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "search_experiment_duration_seconds",
+			Help:    "Время поиска по вариантам A/B экспериментов",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"experiment", "variant", "handler"},
+	)
 	cpuUsage = prometheus.NewGauge(
 		prometheus.GaugeOpts{
 			Name: "go_app_cpu_usage_percent",
@@ -54,8 +83,24 @@ func RequestDuration(handler, method string, val float64) {
 	requestDuration.WithLabelValues(handler, method).Observe(val)
 }
 
+// ExperimentSearch учитывает поисковый запрос варианта эксперимента: время и пустую выдачу
+func ExperimentSearch(experiment, variant, handler string, val float64, zeroResults bool) {
+	experimentRequests.WithLabelValues(experiment, variant, handler).Inc()
+	experimentDuration.WithLabelValues(experiment, variant, handler).Observe(val)
+	if zeroResults {
+		experimentZeroResults.WithLabelValues(experiment, variant, handler).Inc()
+	}
+}
+
+// ExperimentError учитывает ошибку поиска варианта эксперимента
+func ExperimentError(experiment, variant, handler string) {
+	experimentRequests.WithLabelValues(experiment, variant, handler).Inc()
+	experimentErrors.WithLabelValues(experiment, variant, handler).Inc()
+}
+
 func init() {
-	prometheus.MustRegister(requestsTotal, errorsTotal, requestDuration, cpuUsage, memUsage)
+	prometheus.MustRegister(requestsTotal, errorsTotal, requestDuration, cpuUsage, memUsage,
+		experimentRequests, experimentErrors, experimentZeroResults, experimentDuration)
 }
 
 func RecordSysMetrics() {
@@ -0,0 +1,352 @@
+package rank
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// scoreVar - переменная формулы с текущей релевантностью документа
+const scoreVar = "_score"
+
+// formulaFuncs - функции, доступные в формулах, и число их аргументов
+var formulaFuncs = map[string]int{
+	"log":   1,
+	"log10": 1,
+	"log1p": 1,
+	"sqrt":  1,
+	"exp":   1,
+	"abs":   1,
+	"pow":   2,
+	"min":   2,
+	"max":   2,
+}
+
+// Formula - разобранная арифметическая формула ранжирования.
+// Поддерживает числа, + - * / ^, скобки, функции formulaFuncs, _score и числовые поля документа.
+type Formula struct {
+	text   string
+	root   node
+	fields []string
+}
+
+// node - узел дерева формулы
+type node interface {
+	eval(vars func(name string) float64) float64
+}
+
+type numNode float64
+
+type varNode string
+
+type negNode struct{ x node }
+
+type binNode struct {
+	op   rune
+	l, r node
+}
+
+type callNode struct {
+	name string
+	args []node
+}
+
+func (n numNode) eval(func(string) float64) float64 { return float64(n) }
+
+func (n varNode) eval(vars func(string) float64) float64 { return vars(string(n)) }
+
+func (n negNode) eval(vars func(string) float64) float64 { return -n.x.eval(vars) }
+
+func (n binNode) eval(vars func(string) float64) float64 {
+	l, r := n.l.eval(vars), n.r.eval(vars)
+	switch n.op {
+	case '+':
+		return l + r
+	case '-':
+		return l - r
+	case '*':
+		return l * r
+	case '/':
+		return l / r
+	default:
+		return math.Pow(l, r)
+	}
+}
+
+func (n callNode) eval(vars func(string) float64) float64 {
+	args := make([]float64, len(n.args))
+	for i, a := range n.args {
+		args[i] = a.eval(vars)
+	}
+	switch n.name {
+	case "log":
+		return math.Log(args[0])
+	case "log10":
+		return math.Log10(args[0])
+	case "log1p":
+		return math.Log1p(args[0])
+	case "sqrt":
+		return math.Sqrt(args[0])
+	case "exp":
+		return math.Exp(args[0])
+	case "abs":
+		return math.Abs(args[0])
+	case "pow":
+		return math.Pow(args[0], args[1])
+	case "min":
+		return math.Min(args[0], args[1])
+	default:
+		return math.Max(args[0], args[1])
+	}
+}
+
+// ParseFormula разбирает формулу. $F заменяется на field, $W - на weight.
+func ParseFormula(text, field string, weight float64) (*Formula, error) {
+	p := &formulaParser{src: []rune(text), field: field, weight: weight}
+	if strings.TrimSpace(text) == "" {
+		return nil, fmt.Errorf("formula is empty")
+	}
+	root, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return nil, p.errorf("unexpected %q", string(p.src[p.pos]))
+	}
+	return &Formula{text: text, root: root, fields: p.fields}, nil
+}
+
+// String - исходный текст формулы
+func (f *Formula) String() string {
+	return f.text
+}
+
+// Fields - поля документа, которые использует формула
+func (f *Formula) Fields() []string {
+	return f.fields
+}
+
+// Eval вычисляет формулу. vars возвращает значение _score или поля документа.
+// Нечисловой результат (деление на 0, log отрицательного числа) считается равным 0.
+func (f *Formula) Eval(vars func(name string) float64) float64 {
+	v := f.root.eval(vars)
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0
+	}
+	return v
+}
+
+// formulaParser - рекурсивный спуск по грамматике:
+//
+//	expr  = term {("+" | "-") term}
+//	term  = unary {("*" | "/") unary}
+//	unary = "-" unary | power
+//	power = primary ["^" unary]
+type formulaParser struct {
+	src    []rune
+	pos    int
+	field  string
+	weight float64
+	fields []string
+}
+
+func (p *formulaParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s at position %d", fmt.Sprintf(format, args...), p.pos)
+}
+
+func (p *formulaParser) skipSpace() {
+	for p.pos < len(p.src) && unicode.IsSpace(p.src[p.pos]) {
+		p.pos++
+	}
+}
+
+// accept пропускает символ r, если он следующий
+func (p *formulaParser) accept(r rune) bool {
+	p.skipSpace()
+	if p.pos < len(p.src) && p.src[p.pos] == r {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *formulaParser) expr() (node, error) {
+	l, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var op rune
+		switch {
+		case p.accept('+'):
+			op = '+'
+		case p.accept('-'):
+			op = '-'
+		default:
+			return l, nil
+		}
+		r, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		l = binNode{op: op, l: l, r: r}
+	}
+}
+
+func (p *formulaParser) term() (node, error) {
+	l, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var op rune
+		switch {
+		case p.accept('*'):
+			op = '*'
+		case p.accept('/'):
+			op = '/'
+		default:
+			return l, nil
+		}
+		r, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l = binNode{op: op, l: l, r: r}
+	}
+}
+
+func (p *formulaParser) unary() (node, error) {
+	if p.accept('-') {
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return negNode{x: x}, nil
+	}
+	return p.power()
+}
+
+func (p *formulaParser) power() (node, error) {
+	base, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept('^') {
+		return base, nil
+	}
+	// степень правоассоциативна: 2^3^2 = 2^(3^2)
+	exp, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return binNode{op: '^', l: base, r: exp}, nil
+}
+
+func (p *formulaParser) primary() (node, error) {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return nil, p.errorf("unexpected end of formula")
+	}
+
+	r := p.src[p.pos]
+	switch {
+	case r == '(':
+		p.pos++
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(')') {
+			return nil, p.errorf("expected ')'")
+		}
+		return x, nil
+
+	case r == '$':
+		if p.pos+1 >= len(p.src) {
+			return nil, p.errorf("expected $F or $W")
+		}
+		switch p.src[p.pos+1] {
+		case 'F':
+			p.pos += 2
+			if p.field == "" {
+				return nil, p.errorf("$F is used but boost field is empty")
+			}
+			return p.variable(p.field), nil
+		case 'W':
+			p.pos += 2
+			return numNode(p.weight), nil
+		}
+		return nil, p.errorf("expected $F or $W")
+
+	case unicode.IsDigit(r) || r == '.':
+		start := p.pos
+		for p.pos < len(p.src) && (unicode.IsDigit(p.src[p.pos]) || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		token := string(p.src[start:p.pos])
+		v, err := strconv.ParseFloat(token, 64)
+		if err != nil {
+			p.pos = start
+			return nil, p.errorf("invalid number %q", token)
+		}
+		return numNode(v), nil
+
+	case unicode.IsLetter(r) || r == '_':
+		start := p.pos
+		for p.pos < len(p.src) && (unicode.IsLetter(p.src[p.pos]) || unicode.IsDigit(p.src[p.pos]) || p.src[p.pos] == '_' || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		name := string(p.src[start:p.pos])
+		if !p.accept('(') {
+			return p.variable(name), nil
+		}
+		return p.call(name, start)
+	}
+
+	return nil, p.errorf("unexpected %q", string(r))
+}
+
+// call разбирает аргументы функции name после открывающей скобки
+func (p *formulaParser) call(name string, start int) (node, error) {
+	arity, ok := formulaFuncs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q at position %d", name, start)
+	}
+	args := make([]node, 0, arity)
+	if !p.accept(')') {
+		for {
+			arg, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.accept(')') {
+				break
+			}
+			if !p.accept(',') {
+				return nil, p.errorf("expected ',' or ')'")
+			}
+		}
+	}
+	if len(args) != arity {
+		return nil, fmt.Errorf("function %q expects %d argument(s), got %d at position %d", name, arity, len(args), start)
+	}
+	return callNode{name: name, args: args}, nil
+}
+
+// variable запоминает поле документа, которое нужно формуле
+func (p *formulaParser) variable(name string) node {
+	if name != scoreVar {
+		for _, f := range p.fields {
+			if f == name {
+				return varNode(name)
+			}
+		}
+		p.fields = append(p.fields, name)
+	}
+	return varNode(name)
+}
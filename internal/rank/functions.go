@@ -0,0 +1,324 @@
+package rank
+
+import (
+	"fmt"
+	"github.com/blevesearch/bleve/v2/search"
+	"math"
+	"searchengine/internal/config"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	gaussDecay       = "gauss"
+	expDecay         = "exp"
+	linearDecay      = "linear"
+	fieldValueFactor = "field_value_factor"
+
+	// defaultDecay - множитель score на расстоянии offset+scale от origin
+	defaultDecay = 0.5
+	originNow    = "now"
+)
+
+// timestampLayouts - форматы, в которых bleve возвращает сохраненные даты
+var timestampLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+// rescorer - функция ранжирования, пересчитывающая score документа после поиска
+type rescorer interface {
+	rescore(score float64, hit *search.DocumentMatch) float64
+	fields() []string
+	// step - описание функции для explain, без значений score
+	step() Step
+}
+
+func (bf boostFormula) rescore(score float64, hit *search.DocumentMatch) float64 {
+	return bf.formula.Eval(func(name string) float64 {
+		if name == scoreVar {
+			return score
+		}
+		value, _ := numberValue(hit.Fields[name])
+		return value
+	})
+}
+
+func (bf boostFormula) fields() []string {
+	return bf.formula.Fields()
+}
+
+func (bf boostFormula) step() Step {
+	return Step{Type: customBoost, Detail: bf.formula.String()}
+}
+
+// decayFunc - gauss, exp или linear по расстоянию значения поля от origin.
+// Для timestamp расстояния считаются в секундах.
+type decayFunc struct {
+	kind      string
+	field     string
+	timestamp bool
+	now       bool
+	origin    float64
+	scale     float64
+	offset    float64
+	decay     float64
+	weight    float64
+}
+
+func (d decayFunc) rescore(score float64, hit *search.DocumentMatch) float64 {
+	var value float64
+	var ok bool
+	if d.timestamp {
+		value, ok = timestampValue(hit.Fields[d.field])
+	} else {
+		value, ok = numberValue(hit.Fields[d.field])
+	}
+	// документ без значения поля не штрафуется
+	if !ok {
+		return score * d.weight
+	}
+
+	origin := d.origin
+	if d.now {
+		origin = float64(time.Now().Unix())
+	}
+	dist := math.Max(0, math.Abs(value-origin)-d.offset)
+
+	var f float64
+	switch d.kind {
+	case gaussDecay:
+		sigma2 := -d.scale * d.scale / (2 * math.Log(d.decay))
+		f = math.Exp(-dist * dist / (2 * sigma2))
+	case expDecay:
+		f = math.Exp(math.Log(d.decay) / d.scale * dist)
+	default:
+		s := d.scale / (1 - d.decay)
+		f = math.Max(0, (s-dist)/s)
+	}
+	return score * f * d.weight
+}
+
+func (d decayFunc) fields() []string {
+	return []string{d.field}
+}
+
+func (d decayFunc) step() Step {
+	origin := strconv.FormatFloat(d.origin, 'g', -1, 64)
+	unit := ""
+	if d.timestamp {
+		origin = time.Unix(int64(d.origin), 0).UTC().Format(time.RFC3339)
+		if d.now {
+			origin = originNow
+		}
+		unit = "s"
+	}
+	return Step{Type: d.kind, Field: d.field, Detail: fmt.Sprintf("origin=%s scale=%g%s offset=%g%s decay=%g weight=%g",
+		origin, d.scale, unit, d.offset, unit, d.decay, d.weight)}
+}
+
+// valueFactor - field_value_factor: score умножается на modifier(factor * значение поля)
+type valueFactor struct {
+	field    string
+	modifier string
+	factor   float64
+	missing  *float64
+	weight   float64
+}
+
+func (v valueFactor) rescore(score float64, hit *search.DocumentMatch) float64 {
+	value, ok := numberValue(hit.Fields[v.field])
+	if !ok {
+		if v.missing == nil {
+			return score * v.weight
+		}
+		value = *v.missing
+	}
+
+	f := applyModifier(v.modifier, v.factor*value)
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		f = 0
+	}
+	return score * f * v.weight
+}
+
+func (v valueFactor) fields() []string {
+	return []string{v.field}
+}
+
+func (v valueFactor) step() Step {
+	detail := fmt.Sprintf("%s(%g * %s) * %g", v.modifier, v.factor, v.field, v.weight)
+	if v.missing != nil {
+		detail += fmt.Sprintf(", missing=%g", *v.missing)
+	}
+	return Step{Type: fieldValueFactor, Field: v.field, Detail: detail}
+}
+
+// modifiers - модификаторы field_value_factor
+var modifiers = []string{"none", "log", "log1p", "log2p", "ln", "ln1p", "ln2p", "square", "sqrt", "reciprocal"}
+
+func applyModifier(modifier string, x float64) float64 {
+	switch modifier {
+	case "log":
+		return math.Log10(x)
+	case "log1p":
+		return math.Log10(1 + x)
+	case "log2p":
+		return math.Log10(2 + x)
+	case "ln":
+		return math.Log(x)
+	case "ln1p":
+		return math.Log1p(x)
+	case "ln2p":
+		return math.Log(2 + x)
+	case "square":
+		return x * x
+	case "sqrt":
+		return math.Sqrt(x)
+	case "reciprocal":
+		return 1 / x
+	default:
+		return x
+	}
+}
+
+// newDecayFunc проверяет параметры decay-буста и готовит функцию
+func newDecayFunc(b config.BoostConfig, fieldType string) (decayFunc, error) {
+	d := decayFunc{kind: b.BoostType, field: b.Field, weight: boostWeight(b), decay: b.Decay}
+	if d.decay == 0 {
+		d.decay = defaultDecay
+	}
+	if d.decay <= 0 || d.decay >= 1 {
+		return d, fmt.Errorf("decay must be between 0 and 1")
+	}
+
+	var err error
+	switch fieldType {
+	case "timestamp":
+		d.timestamp = true
+		d.now = b.Origin == "" || b.Origin == originNow
+		if !d.now {
+			d.origin, err = parseTimestamp(string(b.Origin))
+			if err != nil {
+				return d, fmt.Errorf("origin: %v", err)
+			}
+		}
+		if d.scale, err = parseDistance(string(b.Scale)); err != nil {
+			return d, fmt.Errorf("scale: %v", err)
+		}
+		if b.Offset != "" {
+			if d.offset, err = parseDistance(string(b.Offset)); err != nil {
+				return d, fmt.Errorf("offset: %v", err)
+			}
+		}
+	case "number":
+		if d.origin, err = strconv.ParseFloat(string(b.Origin), 64); err != nil {
+			return d, fmt.Errorf("origin must be a number")
+		}
+		if d.scale, err = strconv.ParseFloat(string(b.Scale), 64); err != nil {
+			return d, fmt.Errorf("scale must be a number")
+		}
+		if b.Offset != "" {
+			if d.offset, err = strconv.ParseFloat(string(b.Offset), 64); err != nil {
+				return d, fmt.Errorf("offset must be a number")
+			}
+		}
+	default:
+		return d, fmt.Errorf("field %q must be number or timestamp", b.Field)
+	}
+
+	if d.scale <= 0 {
+		return d, fmt.Errorf("scale must be positive")
+	}
+	if d.offset < 0 {
+		return d, fmt.Errorf("offset must be >= 0")
+	}
+	return d, nil
+}
+
+// newValueFactor проверяет параметры field_value_factor
+func newValueFactor(b config.BoostConfig, fieldType string) (valueFactor, error) {
+	v := valueFactor{field: b.Field, modifier: b.Modifier, factor: b.Factor, missing: b.Missing, weight: boostWeight(b)}
+	if fieldType != "number" {
+		return v, fmt.Errorf("field %q is not numeric", b.Field)
+	}
+	if v.modifier == "" {
+		v.modifier = "none"
+	}
+	known := false
+	for _, m := range modifiers {
+		known = known || m == v.modifier
+	}
+	if !known {
+		return v, fmt.Errorf("unknown modifier %q, expected one of %s", v.modifier, strings.Join(modifiers, ", "))
+	}
+	if v.factor == 0 {
+		v.factor = 1
+	}
+	return v, nil
+}
+
+// boostWeight - множитель функции ранжирования, weight не задан - 1
+func boostWeight(b config.BoostConfig) float64 {
+	if b.Weight > 0 {
+		return b.Weight
+	}
+	return 1
+}
+
+// parseDistance разбирает длительность для дат: "90m", "12h", "30d", "2w" - в секундах
+func parseDistance(s string) (float64, error) {
+	if s == "" {
+		return 0, fmt.Errorf("is required")
+	}
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			v, err := strconv.ParseFloat(n, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			return v * unit.Seconds(), nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d.Seconds(), nil
+}
+
+// parseTimestamp разбирает дату в секунды Unix
+func parseTimestamp(s string) (float64, error) {
+	for _, layout := range timestampLayouts {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return float64(t.Unix()), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid date %q", s)
+}
+
+// timestampValue - дата из сохраненных полей документа в секундах Unix
+func timestampValue(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case string:
+		ts, err := parseTimestamp(val)
+		return ts, err == nil
+	case []interface{}:
+		if len(val) > 0 {
+			return timestampValue(val[0])
+		}
+	}
+	return 0, false
+}
+
+// numberValue - число из сохраненных полей документа, false - если поля нет
+func numberValue(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case float64:
+		return val, true
+	case []interface{}:
+		if len(val) > 0 {
+			return numberValue(val[0])
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,384 @@
+package rank
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/blevesearch/bleve/v2/search"
+	"math"
+	"os"
+	"path/filepath"
+	"searchengine/internal/config"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	modelCatboost = "catboost"
+	modelXGBoost  = "xgboost"
+
+	// признаки модели: _score, match_count:<поле>, age:<поле> и имя числового поля
+	matchCountFeature = "match_count:"
+	ageFeature        = "age:"
+)
+
+// ensemble - ансамбль деревьев, предсказание по вектору признаков
+type ensemble interface {
+	predict(x []float64) float64
+}
+
+// Model - модель learning-to-rank: признаки в порядке обучения и ансамбль деревьев
+type Model struct {
+	features []feature
+	trees    ensemble
+}
+
+// feature - признак документа для модели
+type feature struct {
+	kind  string
+	field string
+}
+
+// LoadModel загружает модель из файла mc.Path относительно dir и проверяет признаки по конфигу индекса
+func LoadModel(dir string, mc *config.ModelConfig, icfg *config.IndexConfig) (*Model, error) {
+	if len(mc.Features) == 0 {
+		return nil, fmt.Errorf("features are empty")
+	}
+	features := make([]feature, 0, len(mc.Features))
+	for _, name := range mc.Features {
+		f, err := parseFeature(name, icfg)
+		if err != nil {
+			return nil, err
+		}
+		features = append(features, f)
+	}
+
+	path, err := modelPath(dir, mc.Path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var trees ensemble
+	switch mc.Format {
+	case modelCatboost:
+		trees, err = parseCatboost(data, len(features))
+	case modelXGBoost:
+		trees, err = parseXGBoost(data, mc.Features, mc.BaseScore)
+	default:
+		return nil, fmt.Errorf("unknown model format %q, expected catboost or xgboost", mc.Format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", mc.Path, err)
+	}
+	return &Model{features: features, trees: trees}, nil
+}
+
+// modelPath - путь к файлу модели в папке конфигов. Как и остальные пути конфигов, mc.Path задается
+// от CONFIG_DIR_PATH (ведущий "/" допустим), выйти из папки через ".." нельзя
+func modelPath(dir, path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("path is empty")
+	}
+	for _, part := range strings.Split(filepath.ToSlash(path), "/") {
+		if part == ".." {
+			return "", fmt.Errorf("path %q must stay inside the config dir", path)
+		}
+	}
+	return filepath.Join(dir, filepath.Clean("/"+path)), nil
+}
+
+// parseFeature разбирает имя признака: _score, match_count:<текстовое поле>, age:<timestamp>, <числовое поле>
+func parseFeature(name string, icfg *config.IndexConfig) (feature, error) {
+	if name == scoreVar {
+		return feature{kind: scoreVar}, nil
+	}
+	if field, ok := strings.CutPrefix(name, matchCountFeature); ok {
+		fieldType, err := indexFieldType(icfg, field)
+		if err != nil {
+			return feature{}, fmt.Errorf("feature %q: %v", name, err)
+		}
+		if fieldType != "string" && fieldType != "keyword" {
+			return feature{}, fmt.Errorf("feature %q: field %q is not text", name, field)
+		}
+		return feature{kind: matchCountFeature, field: field}, nil
+	}
+	if field, ok := strings.CutPrefix(name, ageFeature); ok {
+		fieldType, err := indexFieldType(icfg, field)
+		if err != nil {
+			return feature{}, fmt.Errorf("feature %q: %v", name, err)
+		}
+		if fieldType != "timestamp" {
+			return feature{}, fmt.Errorf("feature %q: field %q is not timestamp", name, field)
+		}
+		return feature{kind: ageFeature, field: field}, nil
+	}
+	if err := numericField(icfg, name); err != nil {
+		return feature{}, fmt.Errorf("feature %q: %v", name, err)
+	}
+	return feature{field: name}, nil
+}
+
+// Predict считает признаки документа и возвращает оценку модели.
+// score - релевантность bleve, отсутствующее значение признака - NaN.
+func (m *Model) Predict(score float64, hit *search.DocumentMatch) float64 {
+	x := make([]float64, len(m.features))
+	for i, f := range m.features {
+		switch f.kind {
+		case scoreVar:
+			x[i] = score
+		case matchCountFeature:
+			x[i] = matchCount(hit, f.field)
+		case ageFeature:
+			ts, ok := timestampValue(hit.Fields[f.field])
+			if !ok {
+				x[i] = math.NaN()
+				continue
+			}
+			// возраст документа в днях
+			x[i] = (float64(time.Now().Unix()) - ts) / (24 * 60 * 60)
+		default:
+			v, ok := numberValue(hit.Fields[f.field])
+			if !ok {
+				v = math.NaN()
+			}
+			x[i] = v
+		}
+	}
+	return m.trees.predict(x)
+}
+
+// needsLocations - модели нужны позиции совпадений для признаков match_count:
+func (m *Model) needsLocations() bool {
+	for _, f := range m.features {
+		if f.kind == matchCountFeature {
+			return true
+		}
+	}
+	return false
+}
+
+// fields - сохраненные поля документа, которые нужны признакам
+func (m *Model) fields() []string {
+	fields := make([]string, 0)
+	for _, f := range m.features {
+		if f.kind != scoreVar && f.kind != matchCountFeature {
+			fields = append(fields, f.field)
+		}
+	}
+	return fields
+}
+
+// matchCount - сколько вхождений терминов запроса найдено в поле. Это число совпадений, а не score поля:
+// score по полям bleve отдает только в explain
+func matchCount(hit *search.DocumentMatch, field string) float64 {
+	count := 0
+	for _, locations := range hit.Locations[field] {
+		count += len(locations)
+	}
+	return float64(count)
+}
+
+// obliviousEnsemble - симметричные деревья CatBoost: на каждом уровне дерева одно условие для всех узлов
+type obliviousEnsemble struct {
+	trees []obliviousTree
+	scale float64
+	bias  float64
+}
+
+type obliviousTree struct {
+	features []int
+	borders  []float64
+	leaves   []float64
+}
+
+func (e *obliviousEnsemble) predict(x []float64) float64 {
+	sum := 0.0
+	for _, t := range e.trees {
+		idx := 0
+		for depth, f := range t.features {
+			// NaN не больше границы - как nan_mode Min в CatBoost
+			if x[f] > t.borders[depth] {
+				idx |= 1 << depth
+			}
+		}
+		sum += t.leaves[idx]
+	}
+	return e.scale*sum + e.bias
+}
+
+// parseCatboost разбирает модель CatBoost, сохраненную через save_model(format="json")
+func parseCatboost(data []byte, featureCount int) (ensemble, error) {
+	var model struct {
+		FeaturesInfo struct {
+			FloatFeatures []struct {
+				FeatureIndex     int `json:"feature_index"`
+				FlatFeatureIndex int `json:"flat_feature_index"`
+			} `json:"float_features"`
+		} `json:"features_info"`
+		ObliviousTrees []struct {
+			LeafValues []float64 `json:"leaf_values"`
+			Splits     []struct {
+				FloatFeatureIndex int     `json:"float_feature_index"`
+				Border            float64 `json:"border"`
+				SplitType         string  `json:"split_type"`
+			} `json:"splits"`
+		} `json:"oblivious_trees"`
+		ScaleAndBias []json.RawMessage `json:"scale_and_bias"`
+	}
+	if err := json.Unmarshal(data, &model); err != nil {
+		return nil, err
+	}
+	if len(model.ObliviousTrees) == 0 {
+		return nil, fmt.Errorf("no oblivious_trees in model")
+	}
+
+	// float_feature_index - номер среди числовых признаков, во входном векторе - flat_feature_index
+	flat := make(map[int]int)
+	for _, f := range model.FeaturesInfo.FloatFeatures {
+		flat[f.FeatureIndex] = f.FlatFeatureIndex
+	}
+
+	e := &obliviousEnsemble{scale: 1}
+	for i, t := range model.ObliviousTrees {
+		if len(t.LeafValues) != 1<<len(t.Splits) {
+			return nil, fmt.Errorf("tree %d: expected %d leaf values, got %d (multiclass models are not supported)", i, 1<<len(t.Splits), len(t.LeafValues))
+		}
+		tree := obliviousTree{leaves: t.LeafValues}
+		for _, s := range t.Splits {
+			if s.SplitType != "" && s.SplitType != "FloatFeature" {
+				return nil, fmt.Errorf("tree %d: split type %s is not supported", i, s.SplitType)
+			}
+			f := s.FloatFeatureIndex
+			if idx, ok := flat[f]; ok {
+				f = idx
+			}
+			if f < 0 || f >= featureCount {
+				return nil, fmt.Errorf("tree %d: feature %d is out of features list", i, f)
+			}
+			tree.features = append(tree.features, f)
+			tree.borders = append(tree.borders, s.Border)
+		}
+		e.trees = append(e.trees, tree)
+	}
+
+	if len(model.ScaleAndBias) == 2 {
+		var bias []float64
+		if err := json.Unmarshal(model.ScaleAndBias[0], &e.scale); err != nil {
+			return nil, fmt.Errorf("scale_and_bias: %v", err)
+		}
+		if err := json.Unmarshal(model.ScaleAndBias[1], &bias); err != nil {
+			return nil, fmt.Errorf("scale_and_bias: %v", err)
+		}
+		if len(bias) > 0 {
+			e.bias = bias[0]
+		}
+	}
+	return e, nil
+}
+
+// xgbEnsemble - деревья XGBoost, сумма листьев плюс base_score
+type xgbEnsemble struct {
+	trees     []*xgbNode
+	baseScore float64
+}
+
+// xgbNode - узел дампа XGBoost; у листа заполнен только Leaf
+type xgbNode struct {
+	NodeID         int        `json:"nodeid"`
+	Split          string     `json:"split"`
+	SplitCondition float64    `json:"split_condition"`
+	Yes            int        `json:"yes"`
+	No             int        `json:"no"`
+	Missing        int        `json:"missing"`
+	Leaf           *float64   `json:"leaf"`
+	Children       []*xgbNode `json:"children"`
+
+	feature int
+	yes, no *xgbNode
+	missing *xgbNode
+}
+
+func (e *xgbEnsemble) predict(x []float64) float64 {
+	sum := e.baseScore
+	for _, n := range e.trees {
+		for n.Leaf == nil {
+			v := x[n.feature]
+			switch {
+			case math.IsNaN(v):
+				n = n.missing
+			case v < n.SplitCondition:
+				n = n.yes
+			default:
+				n = n.no
+			}
+		}
+		sum += *n.Leaf
+	}
+	return sum
+}
+
+// parseXGBoost разбирает дамп модели XGBoost: get_dump(dump_format="json"), список деревьев в JSON.
+// Признаки в split - имена из features или f0, f1, ...
+func parseXGBoost(data []byte, features []string, baseScore float64) (ensemble, error) {
+	var trees []*xgbNode
+	if err := json.Unmarshal(data, &trees); err != nil {
+		return nil, err
+	}
+	if len(trees) == 0 {
+		return nil, fmt.Errorf("no trees in model")
+	}
+
+	for i, t := range trees {
+		if err := linkXGBNode(t, features); err != nil {
+			return nil, fmt.Errorf("tree %d: %v", i, err)
+		}
+	}
+	return &xgbEnsemble{trees: trees, baseScore: baseScore}, nil
+}
+
+// linkXGBNode связывает узел с дочерними по yes/no/missing и находит номер признака
+func linkXGBNode(n *xgbNode, features []string) error {
+	if n.Leaf != nil {
+		return nil
+	}
+
+	n.feature = -1
+	for i, name := range features {
+		if name == n.Split {
+			n.feature = i
+		}
+	}
+	if n.feature < 0 {
+		idx, err := strconv.Atoi(strings.TrimPrefix(n.Split, "f"))
+		if err != nil || !strings.HasPrefix(n.Split, "f") || idx < 0 || idx >= len(features) {
+			return fmt.Errorf("node %d: unknown feature %q", n.NodeID, n.Split)
+		}
+		n.feature = idx
+	}
+
+	for _, c := range n.Children {
+		switch c.NodeID {
+		case n.Yes:
+			n.yes = c
+		case n.No:
+			n.no = c
+		}
+		if c.NodeID == n.Missing {
+			n.missing = c
+		}
+		if err := linkXGBNode(c, features); err != nil {
+			return err
+		}
+	}
+	if n.yes == nil || n.no == nil {
+		return fmt.Errorf("node %d: children not found", n.NodeID)
+	}
+	if n.missing == nil {
+		n.missing = n.yes
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package rank
+
+import (
+	"errors"
+	"github.com/blevesearch/bleve/v2/search"
+	"math"
+	"searchengine/internal/config"
+	"slices"
+	"sort"
+)
+
+// DefaultProfile - профиль из корня rank_config.json, используется, если профиль не выбран
+const DefaultProfile = "default"
+
+// ErrUnknownProfile - запрошен профиль ранжирования, которого нет в конфиге
+var ErrUnknownProfile = errors.New("unknown rank profile")
+
+// Profile - профиль ранжирования: бусты полей, функции ранжирования и модель.
+// Профиль не меняется после загрузки конфига, новый конфиг создает новые профили.
+type Profile struct {
+	Name      string
+	cfg       config.RankProfile
+	rescorers []rescorer
+	model     *Model
+}
+
+// FieldBoost - вес совпадения в поле при подсчете релевантности
+type FieldBoost struct {
+	Field string  `json:"field"`
+	Boost float64 `json:"boost"`
+}
+
+// FieldBoosts возвращает веса полей для бустов, которые применяются при поиске:
+// value (и устаревший catboostV2) - вес как есть, logarithmic - 1+ln(1+вес).
+// Поле с нулевым весом не бустится.
+func (p *Profile) FieldBoosts() []FieldBoost {
+	boosts := make([]FieldBoost, 0, len(p.cfg.Boosts))
+	for _, b := range p.cfg.Boosts {
+		if b.Weight <= 0 {
+			continue
+		}
+		switch b.BoostType {
+		case value, catboostV2, "":
+			boosts = append(boosts, FieldBoost{Field: b.Field, Boost: b.Weight})
+		case logarithmic:
+			boosts = append(boosts, FieldBoost{Field: b.Field, Boost: 1 + math.Log1p(b.Weight)})
+		}
+	}
+	return boosts
+}
+
+// HasRescorers сообщает, что выдачу нужно пересчитать функциями ранжирования или моделью после поиска
+func (p *Profile) HasRescorers() bool {
+	return len(p.rescorers) > 0 || p.model != nil
+}
+
+// NeedsLocations сообщает, что признакам модели нужны позиции совпадений в полях
+func (p *Profile) NeedsLocations() bool {
+	return p.model != nil && p.model.needsLocations()
+}
+
+// RescoreFields - поля документа, которые нужны функциям ранжирования и модели
+func (p *Profile) RescoreFields() []string {
+	fields := make([]string, 0)
+	if p.model != nil {
+		fields = append(fields, p.model.fields()...)
+	}
+	for _, r := range p.rescorers {
+		fields = append(fields, r.fields()...)
+	}
+	slices.Sort(fields)
+	return slices.Compact(fields)
+}
+
+// RescoreWindow - сколько лучших документов пересчитывается функциями ранжирования и моделью
+func (p *Profile) RescoreWindow() int {
+	if p.cfg.RescoreWindow > 0 {
+		return p.cfg.RescoreWindow
+	}
+	return defaultRescoreWindow
+}
+
+// Explanation - вклад профиля ранжирования в score документа
+type Explanation struct {
+	Profile string `json:"profile"`
+	// FieldBoosts - веса полей, примененные при построении запроса; их вклад - в объяснении bleve
+	FieldBoosts []FieldBoost `json:"field_boosts,omitempty"`
+	// Score - релевантность bleve до пересчета
+	Score float64 `json:"score"`
+	// Steps - пересчет score моделью и функциями ранжирования по порядку
+	Steps []Step `json:"steps,omitempty"`
+}
+
+// Step - один шаг пересчета score
+type Step struct {
+	Type   string  `json:"type"`
+	Field  string  `json:"field,omitempty"`
+	Detail string  `json:"detail,omitempty"`
+	Before float64 `json:"before"`
+	After  float64 `json:"after"`
+}
+
+// Rescore пересчитывает score документов и сортирует документы по новому score.
+// Сначала модель заменяет релевантность своей оценкой, затем функции ранжирования применяются в порядке конфига,
+// каждая получает score после предыдущей. С explain возвращает объяснения пересчета по id документа.
+func (p *Profile) Rescore(hits search.DocumentMatchCollection, explain bool) map[string]*Explanation {
+	var explanations map[string]*Explanation
+	if explain {
+		explanations = make(map[string]*Explanation, len(hits))
+	}
+
+	for _, hit := range hits {
+		var e *Explanation
+		if explain {
+			e = p.Explain(hit.Score)
+			explanations[hit.ID] = e
+		}
+		hit.Score = p.rescoreHit(hit, e)
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	return explanations
+}
+
+// Explain - объяснение без шагов пересчета: профиль, веса полей и score bleve
+func (p *Profile) Explain(score float64) *Explanation {
+	return &Explanation{Profile: p.Name, FieldBoosts: p.FieldBoosts(), Score: score}
+}
+
+// rescoreHit считает новый score документа; если e не nil - записывает в него шаги
+func (p *Profile) rescoreHit(hit *search.DocumentMatch, e *Explanation) float64 {
+	score := hit.Score
+	if p.model != nil {
+		before := score
+		score = p.model.Predict(score, hit)
+		if e != nil {
+			e.Steps = append(e.Steps, Step{Type: "model", Detail: p.cfg.Model.Format + ": " + p.cfg.Model.Path, Before: before, After: score})
+		}
+	}
+	for _, r := range p.rescorers {
+		before := score
+		score = r.rescore(score, hit)
+		if e != nil {
+			step := r.step()
+			step.Before, step.After = before, score
+			e.Steps = append(e.Steps, step)
+		}
+	}
+	return score
+}
@@ -3,26 +3,166 @@ package rank
 import (
 	"fmt"
 	"github.com/blevesearch/bleve/v2"
+	"log"
 	"searchengine/internal/common/constants"
 	"searchengine/internal/config"
+	"slices"
+	"sync"
 )
 
 const (
 	customBoost = "custom"
 	catboostV2  = "catboostV2"
 	logarithmic = "logarithmic"
+	value       = "value"
 )
 
+// defaultRescoreWindow - размер окна пересчета функциями ранжирования и моделью, если rescore_window не задан
+const defaultRescoreWindow = 100
+
 type RankingClient struct {
-	cfg *config.RankConfig
+	cfg        *config.RankConfig
+	icfg       *config.IndexConfig
+	cfgDir     string
+	mu         *sync.RWMutex
+	profiles   map[string]*Profile
+	categories map[string]string
+}
+
+func New(cfg *config.Config) (*RankingClient, error) {
+	rc := &RankingClient{icfg: cfg.IndexCfg, cfgDir: cfg.CfgDirPath, mu: new(sync.RWMutex)}
+	if err := rc.SetCfg(cfg.RankCfg); err != nil {
+		return nil, err
+	}
+	return rc, nil
+}
+
+// SetCfg проверяет конфиг ранжирования, загружает модели профилей и применяет их.
+// При ошибке текущий конфиг и модели не меняются.
+func (rc *RankingClient) SetCfg(cfg *config.RankConfig) error {
+	rc.mu.RLock()
+	icfg := rc.icfg
+	rc.mu.RUnlock()
+
+	profiles, categories, err := rc.compile(cfg, icfg)
+	if err != nil {
+		return err
+	}
+
+	rc.mu.Lock()
+	rc.cfg, rc.profiles, rc.categories = cfg, profiles, categories
+	rc.mu.Unlock()
+	return nil
+}
+
+// Candidate готовит отдельный клиент ранжирования с конфигом cfg - например, для оценки конфига до применения.
+// Текущий клиент не меняется.
+func (rc *RankingClient) Candidate(cfg *config.RankConfig) (*RankingClient, error) {
+	rc.mu.RLock()
+	icfg := rc.icfg
+	rc.mu.RUnlock()
+
+	candidate := &RankingClient{icfg: icfg, cfgDir: rc.cfgDir, mu: new(sync.RWMutex)}
+	if err := candidate.SetCfg(cfg); err != nil {
+		return nil, err
+	}
+	return candidate, nil
 }
 
-func New(cfg *config.RankConfig) *RankingClient {
-	return &RankingClient{cfg: cfg}
+// SetIndexCfg обновляет конфиг индекса, по которому проверяются поля функций ранжирования и признаки моделей
+func (rc *RankingClient) SetIndexCfg(icfg *config.IndexConfig) {
+	rc.mu.RLock()
+	cfg := rc.cfg
+	rc.mu.RUnlock()
+
+	profiles, categories, err := rc.compile(cfg, icfg)
+	if err != nil {
+		log.Println("[RANK][ERROR] rank config doesn't match new index config:", err)
+	}
+
+	rc.mu.Lock()
+	rc.icfg = icfg
+	if err == nil {
+		rc.profiles, rc.categories = profiles, categories
+	}
+	rc.mu.Unlock()
 }
 
-func (rc *RankingClient) SetCfg(cfg *config.RankConfig) {
-	rc.cfg = cfg
+// Profile выбирает профиль ранжирования: явно указанный name, иначе профиль категории, иначе профиль по умолчанию
+func (rc *RankingClient) Profile(name, category string) (*Profile, error) {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+
+	if name == "" {
+		name = rc.categories[category]
+	}
+	if name == "" {
+		name = DefaultProfile
+	}
+	p, ok := rc.profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProfile, name)
+	}
+	return p, nil
+}
+
+// compile проверяет конфиг и готовит профили: профиль по умолчанию из корня конфига и именованные из profiles.
+// Возвращает профили по имени и имя профиля для каждой категории.
+func (rc *RankingClient) compile(cfg *config.RankConfig, icfg *config.IndexConfig) (map[string]*Profile, map[string]string, error) {
+	if len(cfg.Categories) > 0 {
+		return nil, nil, fmt.Errorf("categories can be set only in profiles")
+	}
+	if _, ok := cfg.Profiles[DefaultProfile]; ok {
+		return nil, nil, fmt.Errorf("profile name %q is reserved for the root of the config", DefaultProfile)
+	}
+
+	def, err := rc.compileProfile(DefaultProfile, cfg.RankProfile, icfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	profiles := map[string]*Profile{DefaultProfile: def}
+	categories := make(map[string]string)
+	for name, pc := range cfg.Profiles {
+		p, err := rc.compileProfile(name, pc, icfg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("profiles.%s: %v", name, err)
+		}
+		profiles[name] = p
+
+		for _, category := range pc.Categories {
+			if !slices.Contains(icfg.Category, category) {
+				return nil, nil, fmt.Errorf("profiles.%s: unknown category %q", name, category)
+			}
+			if other, ok := categories[category]; ok {
+				return nil, nil, fmt.Errorf("profiles.%s: category %q is already used by profile %s", name, category, other)
+			}
+			categories[category] = name
+		}
+	}
+	return profiles, categories, nil
+}
+
+// compileProfile проверяет профиль и готовит его функции ранжирования и модель
+func (rc *RankingClient) compileProfile(name string, cfg config.RankProfile, icfg *config.IndexConfig) (*Profile, error) {
+	rescorers, err := compileRescorers(cfg, icfg)
+	if err != nil {
+		return nil, err
+	}
+	p := &Profile{Name: name, cfg: cfg, rescorers: rescorers}
+	if cfg.Model == nil {
+		return p, nil
+	}
+	// catboostV2 в бустах - устаревший вес поля, а не модель: вместе с моделью такой конфиг вводит в заблуждение
+	for i, b := range cfg.Boosts {
+		if b.BoostType == catboostV2 {
+			return nil, fmt.Errorf("boosts[%d]: catboostV2 is a legacy field boost, use value; the model is set in \"model\"", i)
+		}
+	}
+	p.model, err = LoadModel(rc.cfgDir, cfg.Model, icfg)
+	if err != nil {
+		return nil, fmt.Errorf("model: %v", err)
+	}
+	return p, nil
 }
 
 //// ApplyRanking добавляет настройки ранжирования в запрос Bleve
@@ -94,6 +234,8 @@ func (rc *RankingClient) SetCfg(cfg *config.RankConfig) {
 //	return nil
 //}
 
+// ApplyRanking задает порядок выдачи: явная сортировка пользователя или релевантность.
+// Веса полей из конфига влияют на релевантность при построении запроса (см. FieldBoosts), а не на сортировку.
 func (rc *RankingClient) ApplyRanking(searchRequest *bleve.SearchRequest, sortField string, sortOrder string) error {
 	var sortOrderList []string
 
@@ -109,75 +251,93 @@ func (rc *RankingClient) ApplyRanking(searchRequest *bleve.SearchRequest, sortFi
 		}
 		sortOrderList = []string{sortField}
 	} else {
-		// Сортировка по умолчанию: релевантность + бусты
-		sortOrderList = []string{"-_score"} // Сначала по релевантности
-
-		// Добавляем бустируемые поля из конфига
-		for _, boost := range rc.cfg.Boosts {
-			// Формируем поле с учетом веса и типа буста
-			sortField := fmt.Sprintf("-%s", boost.Field)
-			if boost.Weight > 0 {
-				switch boost.BoostType {
-				case "value":
-					sortField = fmt.Sprintf("-%s^%.2f", boost.Field, boost.Weight)
-				case "logarithmic":
-					sortField = fmt.Sprintf("-%s^log", boost.Field)
-				case "custom":
-					// Кастомная логика, например, умножение на коэффициент
-					sortField = fmt.Sprintf("-%s*%.2f", boost.Field, boost.Weight)
-				}
+		sortOrderList = []string{"-_score"} // По убыванию релевантности
+	}
+
+	// Стабильный порядок документов с одинаковыми значениями сортировки - нужен для курсоров
+	sortOrderList = append(sortOrderList, "_id")
+
+	searchRequest.SortBy(sortOrderList)
+	return nil
+}
+
+// boostFormula - формула custom-буста, разобранная при загрузке конфига
+type boostFormula struct {
+	formula *Formula
+}
+
+// newRescorer готовит функцию ранжирования буста, nil - буст применяется при построении запроса (см. FieldBoosts)
+func newRescorer(b config.BoostConfig, icfg *config.IndexConfig) (rescorer, error) {
+	switch b.BoostType {
+	case value, catboostV2, logarithmic, "":
+		return nil, nil
+
+	case customBoost:
+		formula, err := ParseFormula(b.Formula, b.Field, b.Weight)
+		if err != nil {
+			return nil, fmt.Errorf("formula: %v", err)
+		}
+		for _, name := range formula.Fields() {
+			if err = numericField(icfg, name); err != nil {
+				return nil, fmt.Errorf("formula: %v", err)
 			}
-			sortOrderList = append(sortOrderList, sortField)
 		}
+		return boostFormula{formula: formula}, nil
+
+	case gaussDecay, expDecay, linearDecay:
+		fieldType, err := indexFieldType(icfg, b.Field)
+		if err != nil {
+			return nil, err
+		}
+		return newDecayFunc(b, fieldType)
+
+	case fieldValueFactor:
+		fieldType, err := indexFieldType(icfg, b.Field)
+		if err != nil {
+			return nil, err
+		}
+		return newValueFactor(b, fieldType)
 	}
+	return nil, fmt.Errorf("unknown boost_type %q", b.BoostType)
+}
 
-	searchRequest.SortBy(sortOrderList)
+// numericField проверяет, что поле есть в индексе и числовое
+func numericField(icfg *config.IndexConfig, name string) error {
+	fieldType, err := indexFieldType(icfg, name)
+	if err != nil {
+		return err
+	}
+	if fieldType != "number" {
+		return fmt.Errorf("field %q is not numeric", name)
+	}
 	return nil
 }
 
-//// ValidateFormula проверяет, что формула корректна и содержит шаблоны $F и $W. // todo
-//func ValidateFormula(formula string) error {
-//	// Проверяем, что формула не пустая
-//	if formula == "" {
-//		return errors.New("formula is empty")
-//	}
-//
-//	// Проверяем наличие шаблонов $F и $W
-//	if !strings.Contains(formula, "$F") {
-//		return errors.New("formula must contain $F (field)")
-//	}
-//	if !strings.Contains(formula, "$W") {
-//		return errors.New("formula must contain $W (weight)")
-//	}
-//
-//	// Проверяем, что формула не содержит недопустимых символов
-//	// (например, можно добавить дополнительные проверки)
-//	invalidChars := []string{"$", "{", "}", "(", ")", "[", "]", "&", "|", "!", "@", "#", "%", "?", "`", "~"}
-//	for _, char := range invalidChars {
-//		if strings.Contains(formula, char) && char != "$" {
-//			return fmt.Errorf("formula contains invalid character: %s", char)
-//		}
-//	}
-//
-//	// Проверяем, что формула может быть использована для подстановки
-//	testField := "testField"
-//	testWeight := 1.0
-//	_, err := ApplyFormula(formula, testField, testWeight)
-//	if err != nil {
-//		return fmt.Errorf("formula is invalid: %v", err)
-//	}
-//
-//	return nil
-//}
-//
-//// ApplyFormula подставляет значения поля и веса в формулу.
-//func ApplyFormula(formula, field string, weight float64) (string, error) {
-//	result := strings.ReplaceAll(formula, "$F", field)
-//	result = strings.ReplaceAll(result, "$W", fmt.Sprintf("%.2f", weight))
-//
-//	if strings.Contains(result, "$F") || strings.Contains(result, "$W") {
-//		return "", errors.New("formula still contains $F or $W after substitution")
-//	}
-//
-//	return result, nil
-//}
+// indexFieldType - тип поля из конфига индекса
+func indexFieldType(icfg *config.IndexConfig, name string) (string, error) {
+	for _, f := range icfg.Fields {
+		if f.Name == name {
+			return f.Type, nil
+		}
+	}
+	return "", fmt.Errorf("unknown field %q", name)
+}
+
+// compileRescorers проверяет бусты: известные типы, корректность формул и параметров функций
+// и то, что они ссылаются на подходящие поля индекса, - и готовит функции ранжирования
+func compileRescorers(cfg config.RankProfile, icfg *config.IndexConfig) ([]rescorer, error) {
+	if cfg.RescoreWindow < 0 {
+		return nil, fmt.Errorf("rescore_window must be >= 0")
+	}
+	rescorers := make([]rescorer, 0)
+	for i, b := range cfg.Boosts {
+		r, err := newRescorer(b, icfg)
+		if err != nil {
+			return nil, fmt.Errorf("boosts[%d]: %v", i, err)
+		}
+		if r != nil {
+			rescorers = append(rescorers, r)
+		}
+	}
+	return rescorers, nil
+}
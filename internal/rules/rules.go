@@ -0,0 +1,197 @@
+package rules
+
+import (
+	"fmt"
+	"searchengine/internal/common/request"
+	"searchengine/internal/common/store"
+	"searchengine/internal/config"
+	"strings"
+)
+
+// Rule - правило мерчандайзинга: условия на запрос и действия с выдачей.
+// Все заданные условия должны выполняться; внутри exact и contains достаточно одного совпадения.
+type Rule struct {
+	ID         string     `json:"id"`
+	Disabled   bool       `json:"disabled,omitempty"`
+	Conditions Conditions `json:"conditions"`
+
+	// Pin - документы, закрепленные на позициях выдачи
+	Pin []Pin `json:"pin,omitempty"`
+	// Hide - документы, которые не показываются
+	Hide []string `json:"hide,omitempty"`
+	// Boost - множители score документов, подходящих под фильтр: больше 1 - поднять, меньше 1 - опустить
+	Boost []Boost `json:"boost,omitempty"`
+}
+
+// Conditions - условия срабатывания правила. Запрос сравнивается без учета регистра и лишних пробелов
+type Conditions struct {
+	// Exact - запрос совпадает с одной из фраз
+	Exact []string `json:"exact,omitempty"`
+	// Contains - запрос содержит одну из фраз целыми словами
+	Contains []string `json:"contains,omitempty"`
+	// Category - категория из фильтра запроса
+	Category string `json:"category,omitempty"`
+}
+
+// Pin - документ на позиции выдачи, позиции с 1
+type Pin struct {
+	ID       string `json:"id"`
+	Position int    `json:"position"`
+}
+
+// Boost - множитель score документов, подходящих под фильтры (формат filters из /search)
+type Boost struct {
+	Filters *request.FilterRequest `json:"filters"`
+	Factor  float64                `json:"factor"`
+}
+
+func (r Rule) GetID() string {
+	return r.ID
+}
+
+// Validate проверяет корректность правила
+func (r Rule) Validate() error {
+	if r.ID == "" {
+		return fmt.Errorf("rule id is empty")
+	}
+	c := r.Conditions
+	if len(c.Exact) == 0 && len(c.Contains) == 0 && c.Category == "" {
+		return fmt.Errorf("rule '%s': conditions are empty", r.ID)
+	}
+	for _, phrase := range append(append([]string{}, c.Exact...), c.Contains...) {
+		if normalize(phrase) == "" {
+			return fmt.Errorf("rule '%s': empty phrase in conditions", r.ID)
+		}
+	}
+	if len(r.Pin) == 0 && len(r.Hide) == 0 && len(r.Boost) == 0 {
+		return fmt.Errorf("rule '%s': actions are empty", r.ID)
+	}
+
+	positions := make(map[int]struct{}, len(r.Pin))
+	for i, p := range r.Pin {
+		if p.ID == "" {
+			return fmt.Errorf("rule '%s': pin[%d]: id is empty", r.ID, i)
+		}
+		if p.Position < 1 {
+			return fmt.Errorf("rule '%s': pin[%d]: position must be >= 1", r.ID, i)
+		}
+		if _, ok := positions[p.Position]; ok {
+			return fmt.Errorf("rule '%s': pin[%d]: position %d is already used", r.ID, i, p.Position)
+		}
+		positions[p.Position] = struct{}{}
+	}
+	for i, id := range r.Hide {
+		if id == "" {
+			return fmt.Errorf("rule '%s': hide[%d]: id is empty", r.ID, i)
+		}
+	}
+	for i, b := range r.Boost {
+		if b.Filters == nil {
+			return fmt.Errorf("rule '%s': boost[%d]: filters are empty", r.ID, i)
+		}
+		if b.Factor <= 0 || b.Factor == 1 {
+			return fmt.Errorf("rule '%s': boost[%d]: factor must be > 0 and != 1", r.ID, i)
+		}
+	}
+	return nil
+}
+
+// Actions - действия всех правил, сработавших на запрос
+type Actions struct {
+	// Rules - id сработавших правил в порядке конфига
+	Rules  []string
+	Pins   []Pin
+	Hide   []string
+	Boosts []RuleBoost
+}
+
+// RuleBoost - множитель вместе с id правила, для объяснения score
+type RuleBoost struct {
+	Boost
+	Rule string
+}
+
+// Empty сообщает, что действий нет
+func (a *Actions) Empty() bool {
+	return a == nil || len(a.Rules) == 0
+}
+
+// RulesClient - правила мерчандайзинга из RULES_CONFIG_PATH; GetAll, Get, Upsert и Delete - от хранилища
+type RulesClient struct {
+	*store.Store[Rule]
+}
+
+// New загружает правила из RULES_CONFIG_PATH. Отсутствующий файл - нет правил
+func New(cfg *config.Config) (*RulesClient, error) {
+	st, err := store.Load[Rule](fmt.Sprintf("%s%s", cfg.CfgDirPath, cfg.RulesConfigPath))
+	if err != nil {
+		return nil, err
+	}
+	return &RulesClient{Store: st}, nil
+}
+
+// Match собирает действия включенных правил, сработавших на запрос, nil - ни одно правило не сработало.
+// Если несколько правил закрепляют документы на одной позиции или один документ, побеждает правило выше в списке.
+func (rc *RulesClient) Match(queryText string, category string) *Actions {
+	q := normalize(queryText)
+	var actions *Actions
+	positions := make(map[int]struct{})
+	pinned := make(map[string]struct{})
+	for _, r := range rc.GetAll() {
+		if r.Disabled || !r.matches(q, category) {
+			continue
+		}
+		if actions == nil {
+			actions = &Actions{}
+		}
+		actions.Rules = append(actions.Rules, r.ID)
+
+		for _, p := range r.Pin {
+			_, busy := positions[p.Position]
+			_, dup := pinned[p.ID]
+			if busy || dup {
+				continue
+			}
+			positions[p.Position] = struct{}{}
+			pinned[p.ID] = struct{}{}
+			actions.Pins = append(actions.Pins, p)
+		}
+		actions.Hide = append(actions.Hide, r.Hide...)
+		for _, b := range r.Boost {
+			actions.Boosts = append(actions.Boosts, RuleBoost{Boost: b, Rule: r.ID})
+		}
+	}
+	return actions
+}
+
+// matches проверяет условия правила для нормализованного запроса q
+func (r Rule) matches(q string, category string) bool {
+	c := r.Conditions
+	if c.Category != "" && !strings.EqualFold(c.Category, category) {
+		return false
+	}
+	if len(c.Exact) > 0 && !anyPhrase(c.Exact, func(phrase string) bool { return q == phrase }) {
+		return false
+	}
+	if len(c.Contains) > 0 && !anyPhrase(c.Contains, func(phrase string) bool {
+		return strings.Contains(" "+q+" ", " "+phrase+" ")
+	}) {
+		return false
+	}
+	return true
+}
+
+// anyPhrase сообщает, что хотя бы одна нормализованная фраза подходит
+func anyPhrase(phrases []string, match func(phrase string) bool) bool {
+	for _, phrase := range phrases {
+		if match(normalize(phrase)) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize приводит запрос к нижнему регистру и схлопывает пробелы
+func normalize(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
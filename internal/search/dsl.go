@@ -0,0 +1,418 @@
+package search
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+	"math"
+	"regexp"
+	"searchengine/internal/config"
+	"searchengine/internal/filter"
+	"strings"
+	"time"
+)
+
+// ErrInvalidQuery - запрос не разбирается или не соответствует конфигу индекса
+var ErrInvalidQuery = errors.New("invalid query")
+
+// allField - полнотекстовый поиск по всем searchable полям
+const allField = "_all"
+
+// dslCompiler переводит JSON DSL запроса в дерево bleve query.Query
+// и проверяет поля по конфигу индекса
+type dslCompiler struct {
+	icfg      *config.IndexConfig
+	filterCli *filter.FilterClient
+}
+
+// matchOptions - развернутая форма match: {"title": {"query": "...", "operator": "and", "fuzziness": 1, "boost": 2}}
+type matchOptions struct {
+	Query     string   `json:"query"`
+	Operator  string   `json:"operator"`
+	Fuzziness int      `json:"fuzziness"`
+	Boost     *float64 `json:"boost"`
+}
+
+// rangeOptions - границы range: {"price": {"gte": 100, "lt": 500}}
+type rangeOptions struct {
+	Gt  interface{} `json:"gt"`
+	Gte interface{} `json:"gte"`
+	Lt  interface{} `json:"lt"`
+	Lte interface{} `json:"lte"`
+}
+
+type boolOptions struct {
+	Must               []json.RawMessage `json:"must"`
+	Should             []json.RawMessage `json:"should"`
+	MustNot            []json.RawMessage `json:"must_not"`
+	MinimumShouldMatch float64           `json:"minimum_should_match"`
+}
+
+// CompileDSL разбирает JSON DSL запроса
+func (sc *SearchClient) CompileDSL(data json.RawMessage) (query.Query, error) {
+	c := &dslCompiler{icfg: sc.indxCli.ICfg, filterCli: sc.filterCli}
+	return c.compile(data, "query")
+}
+
+func (c *dslCompiler) compile(data json.RawMessage, path string) (query.Query, error) {
+	var node map[string]json.RawMessage
+	err := json.Unmarshal(data, &node)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: expected object: %v", ErrInvalidQuery, path, err)
+	}
+	if len(node) != 1 {
+		return nil, fmt.Errorf("%w: %s: expected exactly one query type, got %d", ErrInvalidQuery, path, len(node))
+	}
+
+	for qType, body := range node {
+		path = path + "." + qType
+		switch qType {
+		case "bool":
+			return c.compileBool(body, path)
+		case "match_all":
+			return bleve.NewMatchAllQuery(), nil
+		case "exists":
+			return c.compileExists(body, path)
+		case "match", "match_phrase", "term", "prefix", "wildcard", "regexp", "range":
+			return c.compileField(qType, body, path)
+		default:
+			return nil, fmt.Errorf("%w: %s: unknown query type", ErrInvalidQuery, path)
+		}
+	}
+	return nil, nil
+}
+
+func (c *dslCompiler) compileBool(body json.RawMessage, path string) (query.Query, error) {
+	var opts boolOptions
+	err := json.Unmarshal(body, &opts)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidQuery, path, err)
+	}
+	if len(opts.Must)+len(opts.Should)+len(opts.MustNot) == 0 {
+		return nil, fmt.Errorf("%w: %s: empty bool query", ErrInvalidQuery, path)
+	}
+
+	compileAll := func(clauses []json.RawMessage, name string) ([]query.Query, error) {
+		res := make([]query.Query, 0, len(clauses))
+		for i, cl := range clauses {
+			q, err := c.compile(cl, fmt.Sprintf("%s.%s[%d]", path, name, i))
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, q)
+		}
+		return res, nil
+	}
+
+	must, err := compileAll(opts.Must, "must")
+	if err != nil {
+		return nil, err
+	}
+	should, err := compileAll(opts.Should, "should")
+	if err != nil {
+		return nil, err
+	}
+	mustNot, err := compileAll(opts.MustNot, "must_not")
+	if err != nil {
+		return nil, err
+	}
+
+	boolQuery := bleve.NewBooleanQuery()
+	boolQuery.AddMust(must...)
+	boolQuery.AddShould(should...)
+	boolQuery.AddMustNot(mustNot...)
+	// Запрос только из must_not: исключаем документы из всех
+	if len(must) == 0 && len(should) == 0 {
+		boolQuery.AddMust(bleve.NewMatchAllQuery())
+	}
+	if opts.MinimumShouldMatch > 0 {
+		if int(opts.MinimumShouldMatch) > len(should) {
+			return nil, fmt.Errorf("%w: %s: minimum_should_match is greater than number of should clauses", ErrInvalidQuery, path)
+		}
+		boolQuery.SetMinShould(opts.MinimumShouldMatch)
+	}
+	return boolQuery, nil
+}
+
+func (c *dslCompiler) compileExists(body json.RawMessage, path string) (query.Query, error) {
+	var opts struct {
+		Field string `json:"field"`
+	}
+	err := json.Unmarshal(body, &opts)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidQuery, path, err)
+	}
+
+	field, err := c.field(opts.Field, path)
+	if err != nil {
+		return nil, err
+	}
+
+	// В bleve нет запроса на наличие поля, поэтому ищем любое значение поля
+	switch field.Type {
+	case "number":
+		inf, negInf := math.Inf(1), math.Inf(-1)
+		inclusive := true
+		q := bleve.NewNumericRangeInclusiveQuery(&negInf, &inf, &inclusive, &inclusive)
+		q.SetField(field.Name)
+		return q, nil
+	case "timestamp":
+		// bleve хранит даты в наносекундах int64, это весь допустимый диапазон
+		q := bleve.NewDateRangeQuery(time.Date(1678, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2262, 1, 1, 0, 0, 0, 0, time.UTC))
+		q.SetField(field.Name)
+		return q, nil
+	case "bool":
+		t, f := bleve.NewBoolFieldQuery(true), bleve.NewBoolFieldQuery(false)
+		t.SetField(field.Name)
+		f.SetField(field.Name)
+		return bleve.NewDisjunctionQuery(t, f), nil
+	default:
+		q := bleve.NewWildcardQuery("*")
+		q.SetField(field.Name)
+		return q, nil
+	}
+}
+
+// compileField разбирает запросы вида {"<тип>": {"<поле>": <значение или параметры>}}
+func (c *dslCompiler) compileField(qType string, body json.RawMessage, path string) (query.Query, error) {
+	var node map[string]json.RawMessage
+	err := json.Unmarshal(body, &node)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: expected object: %v", ErrInvalidQuery, path, err)
+	}
+	if len(node) != 1 {
+		return nil, fmt.Errorf("%w: %s: expected exactly one field, got %d", ErrInvalidQuery, path, len(node))
+	}
+
+	for name, value := range node {
+		path = path + "." + name
+
+		if name == allField && (qType == "match" || qType == "match_phrase") {
+			return c.compileText(qType, config.FieldConfig{Name: allField, Type: "string"}, value, path)
+		}
+
+		field, err := c.field(name, path)
+		if err != nil {
+			return nil, err
+		}
+
+		switch qType {
+		case "range":
+			return c.compileRange(field, value, path)
+		case "term":
+			return c.compileTerm(field, value, path)
+		default:
+			if field.Type != "string" && field.Type != "keyword" {
+				return nil, fmt.Errorf("%w: %s: %s is applicable only to string and keyword fields", ErrInvalidQuery, path, qType)
+			}
+			return c.compileText(qType, field, value, path)
+		}
+	}
+	return nil, nil
+}
+
+func (c *dslCompiler) compileText(qType string, field config.FieldConfig, value json.RawMessage, path string) (query.Query, error) {
+	var opts matchOptions
+	if err := json.Unmarshal(value, &opts.Query); err != nil {
+		err = json.Unmarshal(value, &opts)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: expected string or object: %v", ErrInvalidQuery, path, err)
+		}
+	}
+	if opts.Query == "" {
+		return nil, fmt.Errorf("%w: %s: empty query", ErrInvalidQuery, path)
+	}
+
+	// prefix и wildcard не анализируются, а термины в индексе в нижнем регистре.
+	// regexp не трогаем: в нижнем регистре \W превратится в \w
+	text := opts.Query
+	if qType == "prefix" || qType == "wildcard" {
+		text = strings.ToLower(text)
+	}
+
+	var q query.Query
+	switch qType {
+	case "match":
+		mq := bleve.NewMatchQuery(text)
+		mq.Fuzziness = opts.Fuzziness
+		switch opts.Operator {
+		case "", "or":
+		case "and":
+			mq.SetOperator(query.MatchQueryOperatorAnd)
+		default:
+			return nil, fmt.Errorf("%w: %s: unknown operator %s", ErrInvalidQuery, path, opts.Operator)
+		}
+		q = mq
+	case "match_phrase":
+		q = bleve.NewMatchPhraseQuery(text)
+	case "prefix":
+		q = bleve.NewPrefixQuery(text)
+	case "wildcard":
+		q = bleve.NewWildcardQuery(text)
+	case "regexp":
+		// некорректное выражение bleve вернул бы только при поиске, как внутреннюю ошибку
+		if _, err := regexp.Compile(text); err != nil {
+			return nil, fmt.Errorf("%w: %s: invalid regexp: %v", ErrInvalidQuery, path, err)
+		}
+		q = bleve.NewRegexpQuery(text)
+	}
+
+	if field.Name != allField {
+		q.(query.FieldableQuery).SetField(field.Name)
+	}
+	if opts.Boost != nil {
+		q.(query.BoostableQuery).SetBoost(*opts.Boost)
+	}
+	return q, nil
+}
+
+func (c *dslCompiler) compileTerm(field config.FieldConfig, value json.RawMessage, path string) (query.Query, error) {
+	var v interface{}
+	err := json.Unmarshal(value, &v)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidQuery, path, err)
+	}
+
+	switch field.Type {
+	case "number":
+		n, ok := v.(float64)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s: expected number", ErrInvalidQuery, path)
+		}
+		inclusive := true
+		q := bleve.NewNumericRangeInclusiveQuery(&n, &n, &inclusive, &inclusive)
+		q.SetField(field.Name)
+		return q, nil
+	case "bool":
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s: expected bool", ErrInvalidQuery, path)
+		}
+		q := bleve.NewBoolFieldQuery(b)
+		q.SetField(field.Name)
+		return q, nil
+	case "timestamp":
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s: expected date string", ErrInvalidQuery, path)
+		}
+		t, err := c.parseDate(s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidQuery, path, err)
+		}
+		inclusive := true
+		q := bleve.NewDateRangeInclusiveQuery(t, t, &inclusive, &inclusive)
+		q.SetField(field.Name)
+		return q, nil
+	default:
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s: expected string", ErrInvalidQuery, path)
+		}
+		if field.Type == "keyword" {
+			s = strings.ToLower(s)
+		}
+		q := bleve.NewTermQuery(s)
+		q.SetField(field.Name)
+		return q, nil
+	}
+}
+
+func (c *dslCompiler) compileRange(field config.FieldConfig, value json.RawMessage, path string) (query.Query, error) {
+	var opts rangeOptions
+	err := json.Unmarshal(value, &opts)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidQuery, path, err)
+	}
+	if opts.Gt != nil && opts.Gte != nil || opts.Lt != nil && opts.Lte != nil {
+		return nil, fmt.Errorf("%w: %s: gt/gte and lt/lte are mutually exclusive", ErrInvalidQuery, path)
+	}
+
+	from, minInclusive := opts.Gte, true
+	if opts.Gt != nil {
+		from, minInclusive = opts.Gt, false
+	}
+	to, maxInclusive := opts.Lte, true
+	if opts.Lt != nil {
+		to, maxInclusive = opts.Lt, false
+	}
+	if from == nil && to == nil {
+		return nil, fmt.Errorf("%w: %s: range without bounds", ErrInvalidQuery, path)
+	}
+
+	switch field.Type {
+	case "number":
+		var min, max *float64
+		for _, b := range []struct {
+			v   interface{}
+			dst **float64
+		}{{from, &min}, {to, &max}} {
+			if b.v == nil {
+				continue
+			}
+			n, ok := b.v.(float64)
+			if !ok {
+				return nil, fmt.Errorf("%w: %s: expected number bounds", ErrInvalidQuery, path)
+			}
+			*b.dst = &n
+		}
+		q := bleve.NewNumericRangeInclusiveQuery(min, max, &minInclusive, &maxInclusive)
+		q.SetField(field.Name)
+		return q, nil
+	case "timestamp":
+		var start, end time.Time
+		for _, b := range []struct {
+			v   interface{}
+			dst *time.Time
+		}{{from, &start}, {to, &end}} {
+			if b.v == nil {
+				continue
+			}
+			s, ok := b.v.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: %s: expected date bounds", ErrInvalidQuery, path)
+			}
+			*b.dst, err = c.parseDate(s)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %v", ErrInvalidQuery, path, err)
+			}
+		}
+		q := bleve.NewDateRangeInclusiveQuery(start, end, &minInclusive, &maxInclusive)
+		q.SetField(field.Name)
+		return q, nil
+	default:
+		return nil, fmt.Errorf("%w: %s: range is applicable only to number and timestamp fields", ErrInvalidQuery, path)
+	}
+}
+
+// field проверяет, что поле есть в конфиге индекса и проиндексировано
+func (c *dslCompiler) field(name, path string) (config.FieldConfig, error) {
+	if name == "category" {
+		return config.FieldConfig{Name: name, Type: "keyword", Filterable: true}, nil
+	}
+	for _, f := range c.icfg.Fields {
+		if f.Name != name {
+			continue
+		}
+		if !f.Searchable && !f.Filterable && !f.Sortable {
+			return f, fmt.Errorf("%w: %s: field is not indexed", ErrInvalidQuery, path)
+		}
+		return f, nil
+	}
+	return config.FieldConfig{}, fmt.Errorf("%w: %s: unknown field %s", ErrInvalidQuery, path, name)
+}
+
+// parseDate разбирает дату в RFC3339 или в формате DATE_LAYOUT
+func (c *dslCompiler) parseDate(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, nil
+	}
+	t, err = c.filterCli.ParseDate(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date: %s", value)
+	}
+	return t, nil
+}
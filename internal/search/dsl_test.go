@@ -0,0 +1,31 @@
+package search
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCompileDSLSkipsSynonymRules(t *testing.T) {
+	sc := newTestClient(t)
+
+	cases := []struct {
+		name  string
+		dsl   string
+		total uint64
+	}{
+		{name: "match_all", dsl: `{"match_all": {}}`, total: 3},
+		{name: "bool must_not only", dsl: `{"bool": {"must_not": [{"term": {"brand": "puma"}}]}}`, total: 2},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			q, err := sc.CompileDSL(json.RawMessage(c.dsl))
+			if err != nil {
+				t.Fatal(err)
+			}
+			total, ids := searchIDs(t, sc, q)
+			if total != c.total || len(ids) != int(c.total) {
+				t.Errorf("total = %d, hits = %v, want %d documents", total, ids, c.total)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package search
+
+import (
+	"fmt"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search"
+	"searchengine/internal/common/request"
+	"searchengine/internal/rank"
+)
+
+// HitExplanation - объяснение score документа: дерево релевантности bleve и вклад профиля ранжирования
+type HitExplanation struct {
+	Bleve *search.Explanation `json:"bleve"`
+	Rank  *rank.Explanation   `json:"rank"`
+}
+
+// ExplainResult - объяснение score одного документа для запроса
+type ExplainResult struct {
+	ID string `json:"id"`
+	// Matched - документ подходит под запрос и фильтры
+	Matched     bool            `json:"matched"`
+	Score       float64         `json:"score,omitempty"`
+	Explanation *HitExplanation `json:"explanation,omitempty"`
+	// Rewrite - как запрос был переписан перед поиском
+	Rewrite *Rewrite `json:"rewrite,omitempty"`
+	// Intent - фильтры, найденные в запросе
+	Intent *Intent `json:"intent,omitempty"`
+}
+
+// Explain объясняет score документа docID для запроса req так, как его посчитал бы поиск:
+// тот же переписанный текстовый запрос, фильтры и профиль ранжирования. Документ должен существовать.
+func (sc *SearchClient) Explain(docID string, req *request.SearchRequest) (*ExplainResult, error) {
+	req, rewrite := sc.rewrite(req)
+	req, intent := sc.extractIntent(req)
+	profile, err := sc.rankProfile(req)
+	if err != nil {
+		return nil, err
+	}
+	textQuery, err := sc.textQuery(req, profile)
+	if err != nil {
+		return nil, err
+	}
+	combinedQuery, err := sc.filteredQuery(textQuery, req.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	// ограничение по id не должно менять score
+	idQuery := bleve.NewDocIDQuery([]string{docID})
+	idQuery.SetBoost(0)
+
+	searchRequest := bleve.NewSearchRequestOptions(bleve.NewConjunctionQuery(combinedQuery, idQuery), 1, 0, true)
+	searchRequest.Fields = []string{"*"}
+	searchRequest.IncludeLocations = profile.NeedsLocations()
+
+	searchResult, err := sc.indxCli.Search(searchRequest)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска: %v", err)
+	}
+
+	result := &ExplainResult{ID: docID, Rewrite: rewrite, Intent: intent}
+	if len(searchResult.Hits) == 0 {
+		return result, nil
+	}
+
+	hit := searchResult.Hits[0]
+	expl := &HitExplanation{Bleve: hit.Expl, Rank: profile.Explain(hit.Score)}
+	// пересчет как в выдаче - только при сортировке по релевантности
+	if req.SortField == "" && profile.HasRescorers() {
+		expl.Rank = profile.Rescore(searchResult.Hits, true)[hit.ID]
+	}
+
+	result.Matched = true
+	result.Score = hit.Score
+	result.Explanation = expl
+	return result, nil
+}
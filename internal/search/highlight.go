@@ -0,0 +1,84 @@
+package search
+
+import (
+	"fmt"
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/highlight"
+	"github.com/blevesearch/bleve/v2/search/highlight/format/ansi"
+	"github.com/blevesearch/bleve/v2/search/highlight/format/html"
+	simpleFragmenter "github.com/blevesearch/bleve/v2/search/highlight/fragmenter/simple"
+	simpleHighlighter "github.com/blevesearch/bleve/v2/search/highlight/highlighter/simple"
+	"searchengine/internal/common/request"
+)
+
+const (
+	HighlightHTML = "html"
+	HighlightANSI = "ansi"
+
+	defaultFragmentSize = 200
+	defaultFragments    = 3
+)
+
+// newHighlighter собирает подсветку bleve с параметрами запроса.
+// Стандартные подсветки bleve регистрируются в маппинге индекса, поэтому с параметрами запроса строим свою.
+func newHighlighter(hr *request.HighlightRequest) (highlight.Highlighter, error) {
+	fragmentSize := hr.FragmentSize
+	if fragmentSize == 0 {
+		fragmentSize = defaultFragmentSize
+	}
+
+	var formatter highlight.FragmentFormatter
+	switch hr.Style {
+	case HighlightHTML, "":
+		pre, post := hr.PreTag, hr.PostTag
+		if pre == "" {
+			pre = "<mark>"
+		}
+		if post == "" {
+			post = "</mark>"
+		}
+		formatter = html.NewFragmentFormatter(pre, post)
+	case HighlightANSI:
+		color := hr.PreTag
+		if color == "" {
+			color = ansi.DefaultAnsiHighlight
+		}
+		formatter = ansi.NewFragmentFormatter(color)
+	default:
+		return nil, fmt.Errorf("unknown highlight style: %s", hr.Style)
+	}
+
+	return simpleHighlighter.NewHighlighter(simpleFragmenter.NewFragmenter(fragmentSize), formatter, "…"), nil
+}
+
+// highlightHit возвращает лучшие фрагменты searchable полей, в которых нашлись термины запроса
+func (sc *SearchClient) highlightHit(h highlight.Highlighter, hr *request.HighlightRequest, hit *search.DocumentMatch) (map[string][]string, error) {
+	fragments := hr.Fragments
+	if fragments == 0 {
+		fragments = defaultFragments
+	}
+
+	doc, err := sc.indxCli.GetDocId(hit.ID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения документа %s: %v", hit.ID, err)
+	}
+	if doc == nil {
+		return nil, nil
+	}
+
+	res := make(map[string][]string)
+	for _, f := range sc.indxCli.ICfg.Fields {
+		if !f.Searchable || f.Type != "string" {
+			continue
+		}
+		// поля без совпадений не подсвечиваем, иначе вернется просто начало текста
+		if _, ok := hit.Locations[f.Name]; !ok {
+			continue
+		}
+		frags := h.BestFragmentsInField(hit, doc, f.Name, fragments)
+		if len(frags) > 0 {
+			res[f.Name] = frags
+		}
+	}
+	return res, nil
+}
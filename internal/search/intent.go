@@ -0,0 +1,319 @@
+package search
+
+import (
+	"github.com/blevesearch/bleve/v2/analysis"
+	"github.com/blevesearch/bleve/v2/analysis/lang/ru"
+	"searchengine/internal/common/request"
+	"searchengine/internal/config"
+	"strconv"
+	"strings"
+)
+
+// Intent - фильтры, найденные в словах запроса, и текст запроса без них
+type Intent struct {
+	// Query - оставшийся текст запроса, по которому шел поиск
+	Query string `json:"query"`
+	// Filters - найденные фильтры в формате filters из /search; явно выбранные фильтры сюда не попадают
+	Filters *request.FilterRequest `json:"filters"`
+}
+
+// слова перед ценой: "от 2000", "до 5000", "дешевле 3000"
+var (
+	rangeFromWords = map[string]struct{}{"от": {}, "дороже": {}}
+	rangeToWords   = map[string]struct{}{"до": {}, "дешевле": {}}
+	// rangeUnits - валюта после числа: "5000 руб", "5000р"
+	rangeUnits = []string{"рублей", "руб", "р", "₽"}
+)
+
+// adjectiveEndings - окончания прилагательных: значения фильтров вроде цвета пишутся в одной форме ("черная"),
+// а в запросе - в любой ("черные"). Остальные слова сравниваются точно, чтобы "белье" не стало цветом "белая".
+var adjectiveEndings = []string{
+	"ая", "яя", "ое", "ее", "ые", "ие", "ый", "ий", "ой", "ую", "юю",
+	"ого", "его", "ых", "их", "ым", "им", "ыми", "ими", "ом", "ем",
+}
+
+// intentValue - значение фильтра из конфига фильтров со словами для сравнения
+type intentValue struct {
+	name  string
+	value string
+	one   bool // one-select, иначе multi-select
+	words []string
+	stems []string
+}
+
+// extractIntent находит в запросе из обычных слов значения multi-select и one-select фильтров категории
+// (без категории - всех категорий) и цены для range-фильтра, удаляет их из текста и добавляет к явным фильтрам.
+// Явно выбранный фильтр не перекрывается. Возвращает исходные параметры, если ничего не найдено.
+func (sc *SearchClient) extractIntent(req *request.SearchRequest) (*request.SearchRequest, *Intent) {
+	if !req.Intent || !plainQuery(req.Query, sc.indxCli.ICfg) {
+		return req, nil
+	}
+
+	var filterCfgs []config.FilterConfig
+	if req.Filters != nil && req.Filters.Category != "" {
+		f, ok := sc.filterCli.GetByCategory(req.Filters.Category)
+		if !ok {
+			return req, nil
+		}
+		filterCfgs = []config.FilterConfig{f}
+	} else {
+		filterCfgs = sc.filterCli.FiltersConfig
+	}
+	explicit := explicitFilters(req.Filters)
+	values, maxWords := intentValues(filterCfgs, explicit)
+	rangeName := intentRange(filterCfgs, explicit)
+
+	tokens := strings.Fields(req.Query)
+	words := make([]string, len(tokens))
+	stems := make([]string, len(tokens))
+	for i, t := range tokens {
+		words[i] = strings.Join(rewriteWords(t), " ")
+		stems[i] = stem(words[i])
+	}
+
+	detected := &request.FilterRequest{}
+	var from, to string
+	out := make([]string, 0, len(tokens))
+	for i := 0; i < len(tokens); {
+		if rangeName != "" {
+			if n, bound, isFrom, ok := matchPrice(words[i:]); ok {
+				if isFrom {
+					from = bound
+				} else {
+					to = bound
+				}
+				i += n
+				continue
+			}
+		}
+		if v, n := matchValue(values, maxWords, words[i:], stems[i:]); v != nil {
+			addDetected(detected, v)
+			i += n
+			continue
+		}
+		out = append(out, tokens[i])
+		i++
+	}
+	if from != "" || to != "" {
+		detected.Range = append(detected.Range, config.RangeFilter{Name: rangeName, Type: "number", FromValue: from, ToValue: to})
+	}
+	if len(detected.MultiSelect) == 0 && len(detected.OneSelect) == 0 && len(detected.Range) == 0 {
+		return req, nil
+	}
+
+	filters := request.FilterRequest{}
+	if req.Filters != nil {
+		filters = *req.Filters
+	}
+	filters.MultiSelect = append(append([]config.MultiSelectFilter{}, filters.MultiSelect...), detected.MultiSelect...)
+	filters.OneSelect = append(append([]request.OneSelectFilterReq{}, filters.OneSelect...), detected.OneSelect...)
+	if len(detected.Range) > 0 {
+		filters.Price = &detected.Range[0]
+	}
+
+	extracted := *req
+	extracted.Query = strings.Join(out, " ")
+	extracted.Filters = &filters
+	return &extracted, &Intent{Query: extracted.Query, Filters: detected}
+}
+
+// plainQuery сообщает, что запрос состоит из обычных слов без синтаксиса
+func plainQuery(queryText string, icfg *config.IndexConfig) bool {
+	groups, err := parseQueryString(queryText, icfg)
+	if err != nil {
+		return false
+	}
+	for _, group := range groups {
+		if len(group) != 1 || !group[0].plain() {
+			return false
+		}
+	}
+	return true
+}
+
+// explicitFilters - имена фильтров, выбранных в запросе явно
+func explicitFilters(filters *request.FilterRequest) map[string]struct{} {
+	explicit := make(map[string]struct{})
+	if filters == nil {
+		return explicit
+	}
+	for _, f := range filters.MultiSelect {
+		explicit[f.Name] = struct{}{}
+	}
+	for _, f := range filters.OneSelect {
+		explicit[f.Name] = struct{}{}
+	}
+	for _, f := range filters.Range {
+		explicit[f.Name] = struct{}{}
+	}
+	return explicit
+}
+
+// intentValues собирает значения фильтров без повторов. maxWords - самое длинное значение в словах
+func intentValues(filterCfgs []config.FilterConfig, explicit map[string]struct{}) ([]intentValue, int) {
+	var values []intentValue
+	seen := make(map[string]struct{})
+	maxWords := 0
+	add := func(name, value string, one bool) {
+		if _, ok := explicit[name]; ok {
+			return
+		}
+		words := rewriteWords(value)
+		key := name + "\x00" + strings.Join(words, " ")
+		if _, ok := seen[key]; ok || len(words) == 0 {
+			return
+		}
+		seen[key] = struct{}{}
+		stems := make([]string, len(words))
+		for i, w := range words {
+			stems[i] = stem(w)
+		}
+		values = append(values, intentValue{name: name, value: value, one: one, words: words, stems: stems})
+		maxWords = max(maxWords, len(words))
+	}
+	for _, fc := range filterCfgs {
+		for _, f := range fc.MultiSelect {
+			for _, v := range f.Value {
+				add(f.Name, v, false)
+			}
+		}
+		for _, f := range fc.OneSelect {
+			for _, v := range f.Value {
+				add(f.Name, v, true)
+			}
+		}
+	}
+	return values, maxWords
+}
+
+// intentRange - числовой range-фильтр с "price": true для цены из запроса; пусто, если такого фильтра нет
+// или отмечено несколько разных
+func intentRange(filterCfgs []config.FilterConfig, explicit map[string]struct{}) string {
+	name := ""
+	for _, fc := range filterCfgs {
+		for _, r := range fc.Range {
+			if !r.Price || r.Type != "number" || r.Name == name {
+				continue
+			}
+			if name != "" {
+				return ""
+			}
+			name = r.Name
+		}
+	}
+	if _, ok := explicit[name]; ok {
+		return ""
+	}
+	return name
+}
+
+// matchValue ищет самое длинное значение фильтра в начале запроса
+func matchValue(values []intentValue, maxWords int, words, stems []string) (*intentValue, int) {
+	for n := min(maxWords, len(words)); n > 0; n-- {
+		for i := range values {
+			v := &values[i]
+			if len(v.words) != n {
+				continue
+			}
+			matched := true
+			for j := 0; j < n && matched; j++ {
+				matched = words[j] == v.words[j] || isAdjective(words[j]) && stems[j] == v.stems[j]
+			}
+			if matched {
+				return v, n
+			}
+		}
+	}
+	return nil, 0
+}
+
+// matchPrice разбирает цену в начале запроса: "от 2000", "до 5000 руб", "дешевле 3000р".
+// Возвращает число слов, границу и то, что это нижняя граница
+func matchPrice(words []string) (int, string, bool, bool) {
+	if len(words) < 2 {
+		return 0, "", false, false
+	}
+	_, isFrom := rangeFromWords[words[0]]
+	_, isTo := rangeToWords[words[0]]
+	if !isFrom && !isTo {
+		return 0, "", false, false
+	}
+	bound, ok := parsePrice(words[1])
+	if !ok {
+		return 0, "", false, false
+	}
+	n := 2
+	if len(words) > 2 && isUnit(words[2]) {
+		n++
+	}
+	return n, bound, isFrom, true
+}
+
+// parsePrice разбирает число, возможно с валютой: "5000", "5000р"
+func parsePrice(word string) (string, bool) {
+	for _, unit := range rangeUnits {
+		if trimmed := strings.TrimSuffix(word, unit); trimmed != word {
+			word = trimmed
+			break
+		}
+	}
+	if _, err := strconv.ParseFloat(word, 64); err != nil {
+		return "", false
+	}
+	return word, true
+}
+
+func isUnit(word string) bool {
+	for _, unit := range rangeUnits {
+		if word == unit {
+			return true
+		}
+	}
+	return false
+}
+
+// addDetected добавляет найденное значение: значения multi-select объединяются через ИЛИ,
+// у one-select остается первое найденное значение
+func addDetected(detected *request.FilterRequest, v *intentValue) {
+	if v.one {
+		for _, f := range detected.OneSelect {
+			if f.Name == v.name {
+				return
+			}
+		}
+		detected.OneSelect = append(detected.OneSelect, request.OneSelectFilterReq{Name: v.name, Value: v.value})
+		return
+	}
+	for i := range detected.MultiSelect {
+		f := &detected.MultiSelect[i]
+		if f.Name != v.name {
+			continue
+		}
+		for _, value := range f.Value {
+			if value == v.value {
+				return
+			}
+		}
+		f.Value = append(f.Value, v.value)
+		return
+	}
+	detected.MultiSelect = append(detected.MultiSelect, config.MultiSelectFilter{Name: v.name, Value: []string{v.value}})
+}
+
+func isAdjective(word string) bool {
+	for _, ending := range adjectiveEndings {
+		if strings.HasSuffix(word, ending) && len([]rune(word)) > len([]rune(ending))+2 {
+			return true
+		}
+	}
+	return false
+}
+
+// stem - основа слова русским стеммером, латиница не меняется
+func stem(word string) string {
+	if word == "" {
+		return ""
+	}
+	tokens := ru.NewRussianStemmerFilter().Filter(analysis.TokenStream{&analysis.Token{Term: []byte(word)}})
+	return string(tokens[0].Term)
+}
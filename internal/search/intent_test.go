@@ -0,0 +1,43 @@
+package search
+
+import (
+	"searchengine/internal/common/request"
+	"searchengine/internal/config"
+	"searchengine/internal/filter"
+	"testing"
+)
+
+func TestIntentPriceNarrowsExplicitRange(t *testing.T) {
+	sc := newTestClient(t)
+	sc.filterCli = filter.New(&config.Config{FilterCfg: []config.FilterConfig{{
+		Category: "Обувь",
+		Range: []config.RangeFilter{
+			{Name: "price", Type: "number", Price: true},
+			{Name: "rating", Type: "number"},
+		},
+	}}})
+
+	req := &request.SearchRequest{
+		Query:  "кроссовки до 4000",
+		Intent: true,
+		Filters: &request.FilterRequest{
+			Range: []config.RangeFilter{{Name: "rating", Type: "number", FromValue: "4"}},
+		},
+	}
+	extracted, intent := sc.extractIntent(req)
+	if intent == nil || extracted.Filters.Price == nil || extracted.Filters.Price.ToValue != "4000" {
+		t.Fatalf("price is not detected: %+v", extracted.Filters)
+	}
+	if len(extracted.Filters.Range) != 1 {
+		t.Errorf("detected price must not be merged into range: %+v", extracted.Filters.Range)
+	}
+
+	q, err := sc.filteredQuery(nil, extracted.Filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total, ids := searchIDs(t, sc, q)
+	if total != 1 || len(ids) != 1 || ids[0] != "2" {
+		t.Errorf("total = %d, hits = %v, want only document 2 (rating >= 4 and price <= 4000)", total, ids)
+	}
+}
@@ -0,0 +1,139 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// variantBoost - вес альтернативных форм запроса относительно исходных слов
+const variantBoost = 0.5
+
+// Раскладки клавиатуры: символы на одних и тех же клавишах
+const (
+	layoutEn = "qwertyuiop[]asdfghjkl;'zxcvbnm,.`"
+	layoutRu = "йцукенгшщзхъфывапролджэячсмитьбюё"
+)
+
+var (
+	enToRuLayout = layoutMap(layoutEn, layoutRu)
+	ruToEnLayout = layoutMap(layoutRu, layoutEn)
+)
+
+// Транслитерация: сначала сочетания из нескольких букв, затем одиночные
+var latToCyr = []struct{ lat, cyr string }{
+	{"shch", "щ"}, {"sch", "щ"},
+	{"yo", "ё"}, {"zh", "ж"}, {"kh", "х"}, {"ts", "ц"}, {"ch", "ч"}, {"sh", "ш"}, {"yu", "ю"}, {"ya", "я"},
+	{"a", "а"}, {"b", "б"}, {"v", "в"}, {"g", "г"}, {"d", "д"}, {"e", "е"}, {"z", "з"}, {"i", "и"},
+	{"j", "й"}, {"y", "й"}, {"k", "к"}, {"l", "л"}, {"m", "м"}, {"n", "н"}, {"o", "о"}, {"p", "п"},
+	{"r", "р"}, {"s", "с"}, {"t", "т"}, {"u", "у"}, {"f", "ф"}, {"h", "х"}, {"c", "ц"}, {"w", "в"},
+	{"x", "кс"}, {"q", "к"},
+}
+
+var cyrToLat = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh", 'з': "z", 'и': "i",
+	'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t",
+	'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "",
+	'э': "e", 'ю': "yu", 'я': "ya",
+}
+
+func layoutMap(from, to string) map[rune]rune {
+	fr, tr := []rune(from), []rune(to)
+	m := make(map[rune]rune, len(fr))
+	for i := range fr {
+		m[fr[i]] = tr[i]
+	}
+	return m
+}
+
+// termVariants возвращает формы слова в другой раскладке и в транслитерации
+func termVariants(term string) []string {
+	term = strings.ToLower(term)
+	variants := make([]string, 0, 2)
+	add := func(v string) {
+		if v == "" || v == term {
+			return
+		}
+		for _, existing := range variants {
+			if existing == v {
+				return
+			}
+		}
+		variants = append(variants, v)
+	}
+
+	switch {
+	case isScript(term, unicode.Latin):
+		add(switchLayout(term, enToRuLayout))
+		add(translitToCyr(term))
+	case isScript(term, unicode.Cyrillic):
+		add(switchLayout(term, ruToEnLayout))
+		add(translitToLat(term))
+	}
+	return variants
+}
+
+// isScript сообщает, что все буквы слова из одного алфавита.
+// Знаки препинания не учитываются: в другой раскладке на их месте буквы ("[jhjibq" - "хорошие").
+func isScript(term string, script *unicode.RangeTable) bool {
+	hasLetter := false
+	for _, r := range term {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		if !unicode.Is(script, r) {
+			return false
+		}
+		hasLetter = true
+	}
+	return hasLetter
+}
+
+// switchLayout перепечатывает слово на другой раскладке; если какой-то символ не переводится - пустая строка
+func switchLayout(term string, m map[rune]rune) string {
+	var b strings.Builder
+	for _, r := range term {
+		c, ok := m[r]
+		if !ok {
+			if unicode.IsDigit(r) || r == '-' {
+				b.WriteRune(r)
+				continue
+			}
+			return ""
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+func translitToCyr(term string) string {
+	var b strings.Builder
+	for len(term) > 0 {
+		matched := false
+		for _, t := range latToCyr {
+			if strings.HasPrefix(term, t.lat) {
+				b.WriteString(t.cyr)
+				term = term[len(t.lat):]
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			r := []rune(term)[0]
+			b.WriteRune(r)
+			term = term[len(string(r)):]
+		}
+	}
+	return b.String()
+}
+
+func translitToLat(term string) string {
+	var b strings.Builder
+	for _, r := range term {
+		if l, ok := cyrToLat[r]; ok {
+			b.WriteString(l)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
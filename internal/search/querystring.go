@@ -0,0 +1,208 @@
+package search
+
+import (
+	"fmt"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+	"searchengine/internal/config"
+	"strings"
+	"unicode"
+)
+
+// ParseError - синтаксическая ошибка в строке запроса. Position - номер символа с 0.
+type ParseError struct {
+	Message  string `json:"message"`
+	Position int    `json:"position"`
+	Token    string `json:"token,omitempty"`
+}
+
+func (e *ParseError) Error() string {
+	if e.Token != "" {
+		return fmt.Sprintf("%s: %s at position %d (%q)", ErrInvalidQuery, e.Message, e.Position, e.Token)
+	}
+	return fmt.Sprintf("%s: %s at position %d", ErrInvalidQuery, e.Message, e.Position)
+}
+
+// Unwrap позволяет проверять ошибку через errors.Is(err, ErrInvalidQuery)
+func (e *ParseError) Unwrap() error {
+	return ErrInvalidQuery
+}
+
+// qsClause - элемент строки запроса: слово или фраза, возможно с полем и исключением
+type qsClause struct {
+	Field    string
+	Value    string
+	Phrase   bool
+	Negate   bool
+	Wildcard bool
+	Pos      int
+}
+
+// plain - обычное слово без синтаксиса, ищется как раньше: нечетко, с синонимами и раскладкой
+func (c qsClause) plain() bool {
+	return c.Field == "" && !c.Phrase && !c.Negate && !c.Wildcard
+}
+
+// parseQueryString разбирает строку запроса в группы. Элементы одной группы соединены OR.
+//
+// Синтаксис: "точная фраза", -исключение, поле:значение, поле:"фраза", a OR b, шаблоны * и ?
+func parseQueryString(queryText string, icfg *config.IndexConfig) ([][]qsClause, error) {
+	runes := []rune(queryText)
+	groups := make([][]qsClause, 0)
+	pendingOr := false
+	orPos := 0
+
+	pos := 0
+	for {
+		for pos < len(runes) && unicode.IsSpace(runes[pos]) {
+			pos++
+		}
+		if pos >= len(runes) {
+			break
+		}
+
+		start := pos
+		clause := qsClause{Pos: start}
+
+		if runes[pos] == '-' {
+			if pos+1 >= len(runes) || unicode.IsSpace(runes[pos+1]) {
+				return nil, &ParseError{Message: "empty exclusion", Position: pos, Token: "-"}
+			}
+			clause.Negate = true
+			pos++
+		}
+
+		// поле:значение
+		if runes[pos] != '"' {
+			end := pos
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && runes[end] != ':' && runes[end] != '"' {
+				end++
+			}
+			if end < len(runes) && runes[end] == ':' && isFieldName(runes[pos:end]) {
+				name := string(runes[pos:end])
+				field, err := scopeField(icfg, name)
+				if err != nil {
+					return nil, &ParseError{Message: err.Error(), Position: pos, Token: name}
+				}
+				clause.Field = field
+				pos = end + 1
+				if pos >= len(runes) || unicode.IsSpace(runes[pos]) {
+					return nil, &ParseError{Message: "empty value for field", Position: start, Token: name + ":"}
+				}
+			}
+		}
+
+		if runes[pos] == '"' {
+			end := pos + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end >= len(runes) {
+				return nil, &ParseError{Message: "unterminated quote", Position: pos, Token: string(runes[pos:])}
+			}
+			clause.Phrase = true
+			clause.Value = strings.TrimSpace(string(runes[pos+1 : end]))
+			if clause.Value == "" {
+				return nil, &ParseError{Message: "empty phrase", Position: pos, Token: string(runes[pos : end+1])}
+			}
+			pos = end + 1
+		} else {
+			end := pos
+			for end < len(runes) && !unicode.IsSpace(runes[end]) {
+				end++
+			}
+			clause.Value = string(runes[pos:end])
+			clause.Wildcard = strings.ContainsAny(clause.Value, "*?")
+			pos = end
+		}
+
+		if clause.plain() && clause.Value == "OR" {
+			if len(groups) == 0 || pendingOr {
+				return nil, &ParseError{Message: "OR without left operand", Position: start, Token: "OR"}
+			}
+			pendingOr, orPos = true, start
+			continue
+		}
+
+		if pendingOr {
+			last := len(groups) - 1
+			if clause.Negate || groups[last][len(groups[last])-1].Negate {
+				return nil, &ParseError{Message: "exclusion can't be combined with OR", Position: orPos, Token: "OR"}
+			}
+			groups[last] = append(groups[last], clause)
+			pendingOr = false
+			continue
+		}
+		groups = append(groups, []qsClause{clause})
+	}
+
+	if pendingOr {
+		return nil, &ParseError{Message: "OR without right operand", Position: orPos, Token: "OR"}
+	}
+	return groups, nil
+}
+
+// isFieldName отличает префикс поля от слова с двоеточием, например времени "10:30"
+func isFieldName(name []rune) bool {
+	if len(name) == 0 || !unicode.IsLetter(name[0]) && name[0] != '_' {
+		return false
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-' && r != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// scopeField проверяет, что по полю можно искать из строки запроса
+func scopeField(icfg *config.IndexConfig, name string) (string, error) {
+	for _, f := range icfg.Fields {
+		if f.Name != name {
+			continue
+		}
+		if !f.Searchable || (f.Type != "string" && f.Type != "keyword") {
+			return "", fmt.Errorf("field is not searchable")
+		}
+		return f.Name, nil
+	}
+	return "", fmt.Errorf("unknown field")
+}
+
+// fieldType - тип поля из конфига индекса
+func fieldType(icfg *config.IndexConfig, name string) string {
+	for _, f := range icfg.Fields {
+		if f.Name == name {
+			return f.Type
+		}
+	}
+	return ""
+}
+
+// clauseQuery строит запрос для элемента строки запроса с синтаксисом
+func clauseQuery(c qsClause, icfg *config.IndexConfig) query.Query {
+	keyword := c.Field != "" && fieldType(icfg, c.Field) == "keyword"
+
+	var q query.Query
+	switch {
+	case c.Wildcard && !c.Phrase:
+		wq := bleve.NewWildcardQuery(strings.ToLower(c.Value))
+		wq.SetField(c.Field)
+		q = wq
+	case keyword:
+		// keyword индексируется целиком в нижнем регистре
+		tq := bleve.NewTermQuery(strings.ToLower(c.Value))
+		tq.SetField(c.Field)
+		q = tq
+	case c.Phrase:
+		pq := bleve.NewMatchPhraseQuery(c.Value)
+		pq.SetField(c.Field)
+		q = pq
+	default:
+		mq := bleve.NewMatchQuery(c.Value)
+		mq.SetField(c.Field)
+		mq.SetOperator(query.MatchQueryOperatorAnd)
+		q = mq
+	}
+	return q
+}
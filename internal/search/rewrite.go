@@ -0,0 +1,239 @@
+package search
+
+import (
+	"fmt"
+	"searchengine/internal/common/request"
+	"searchengine/internal/config"
+	"searchengine/internal/filter"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Rewrite - как запрос был переписан перед поиском
+type Rewrite struct {
+	// Query - переписанный запрос, по которому шел поиск
+	Query string `json:"query"`
+	// StopWords - удаленные стоп-слова
+	StopWords []string `json:"stop_words,omitempty"`
+	// Replacements - выполненные замены
+	Replacements []Replacement `json:"replacements,omitempty"`
+	// Filters - фильтры, полученные из фраз запроса
+	Filters []config.MultiSelectFilter `json:"filters,omitempty"`
+}
+
+type Replacement struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// rewriteAction - что сделать с фразой запроса: удалить, заменить на to или превратить в фильтр
+type rewriteAction struct {
+	to     string
+	filter *config.RewriteFilter
+}
+
+// Rewriter переписывает запрос по правилам из REWRITE_CONFIG_PATH
+type Rewriter struct {
+	cfg       *config.RewriteConfig
+	filterCli *filter.FilterClient
+
+	// фраза в нижнем регистре -> действие; maxWords - самая длинная фраза в словах
+	actions  map[string]rewriteAction
+	maxWords int
+
+	mu *sync.RWMutex
+}
+
+func NewRewriter(cfg *config.RewriteConfig, filterCli *filter.FilterClient) (*Rewriter, error) {
+	rw := &Rewriter{filterCli: filterCli, mu: new(sync.RWMutex)}
+	if err := rw.SetCfg(cfg); err != nil {
+		return nil, err
+	}
+	return rw, nil
+}
+
+// GetCfg возвращает текущие правила
+func (rw *Rewriter) GetCfg() *config.RewriteConfig {
+	rw.mu.RLock()
+	defer rw.mu.RUnlock()
+	return rw.cfg
+}
+
+// SetCfg проверяет правила и фильтры правил по конфигу фильтров и применяет их. При ошибке текущие правила не меняются
+func (rw *Rewriter) SetCfg(cfg *config.RewriteConfig) error {
+	if cfg == nil {
+		cfg = &config.RewriteConfig{}
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if err := cfg.ValidateFilters(rw.filterCli.FiltersConfig); err != nil {
+		return err
+	}
+
+	actions := make(map[string]rewriteAction)
+	maxWords := 0
+	add := func(phrase string, action rewriteAction) error {
+		words := rewriteWords(phrase)
+		key := strings.Join(words, " ")
+		if key == "" {
+			return fmt.Errorf("phrase '%s' has no words", phrase)
+		}
+		if _, ok := actions[key]; ok {
+			return fmt.Errorf("phrase '%s' is used in several rules", phrase)
+		}
+		actions[key] = action
+		maxWords = max(maxWords, len(words))
+		return nil
+	}
+	for _, w := range cfg.StopWords {
+		if err := add(w, rewriteAction{}); err != nil {
+			return err
+		}
+	}
+	for _, r := range cfg.Replacements {
+		for _, phrase := range r.From {
+			if err := add(phrase, rewriteAction{to: r.To}); err != nil {
+				return err
+			}
+		}
+	}
+	for i := range cfg.Filters {
+		for _, phrase := range cfg.Filters[i].From {
+			if err := add(phrase, rewriteAction{filter: &cfg.Filters[i]}); err != nil {
+				return err
+			}
+		}
+	}
+
+	rw.mu.Lock()
+	rw.cfg, rw.actions, rw.maxWords = cfg, actions, maxWords
+	rw.mu.Unlock()
+	return nil
+}
+
+// Rewrite переписывает запрос из обычных слов: удаляет стоп-слова, заменяет слова и фразы, превращает фразы в фильтры.
+// Фразы ищутся слева направо, из нескольких подходящих выбирается самая длинная; замена повторно не переписывается.
+// nil - запрос не изменился или от него ничего бы не осталось.
+func (rw *Rewriter) Rewrite(queryText string) *Rewrite {
+	rw.mu.RLock()
+	defer rw.mu.RUnlock()
+
+	if len(rw.actions) == 0 {
+		return nil
+	}
+
+	tokens := strings.Fields(queryText)
+	words := make([]string, len(tokens))
+	for i, t := range tokens {
+		words[i] = strings.Join(rewriteWords(t), " ")
+	}
+
+	res := &Rewrite{}
+	out := make([]string, 0, len(tokens))
+	changed := false
+	for i := 0; i < len(tokens); {
+		n, action, ok := rw.match(words[i:])
+		if !ok {
+			out = append(out, tokens[i])
+			i++
+			continue
+		}
+		phrase := strings.Join(words[i:i+n], " ")
+		changed = true
+		i += n
+
+		switch {
+		case action.filter != nil:
+			res.addFilter(action.filter.Name, action.filter.Value)
+		case action.to != "":
+			res.Replacements = append(res.Replacements, Replacement{From: phrase, To: action.to})
+			out = append(out, action.to)
+		default:
+			res.StopWords = append(res.StopWords, phrase)
+		}
+	}
+
+	if !changed || len(out) == 0 && len(res.Filters) == 0 {
+		return nil
+	}
+	res.Query = strings.Join(out, " ")
+	return res
+}
+
+// match ищет самую длинную фразу из правил в начале words
+func (rw *Rewriter) match(words []string) (int, rewriteAction, bool) {
+	for n := min(rw.maxWords, len(words)); n > 0; n-- {
+		if action, ok := rw.actions[strings.Join(words[:n], " ")]; ok {
+			return n, action, true
+		}
+	}
+	return 0, rewriteAction{}, false
+}
+
+// addFilter добавляет значение фильтра, значения одного фильтра объединяются через OR
+func (r *Rewrite) addFilter(name, value string) {
+	for i := range r.Filters {
+		if r.Filters[i].Name != name {
+			continue
+		}
+		for _, v := range r.Filters[i].Value {
+			if strings.EqualFold(v, value) {
+				return
+			}
+		}
+		r.Filters[i].Value = append(r.Filters[i].Value, value)
+		return
+	}
+	r.Filters = append(r.Filters, config.MultiSelectFilter{Name: name, Value: []string{value}})
+}
+
+// applyRewrite применяет переписанный запрос к копии параметров поиска.
+// Фильтр из запроса не добавляется, если такой фильтр уже выбран явно; в rw остаются только добавленные фильтры.
+func applyRewrite(req *request.SearchRequest, rw *Rewrite) *request.SearchRequest {
+	rewritten := *req
+	rewritten.Query = rw.Query
+	if len(rw.Filters) == 0 {
+		return &rewritten
+	}
+
+	filters := request.FilterRequest{}
+	if req.Filters != nil {
+		filters = *req.Filters
+	}
+	explicit := make(map[string]struct{})
+	for _, f := range filters.MultiSelect {
+		explicit[f.Name] = struct{}{}
+	}
+	for _, f := range filters.OneSelect {
+		explicit[f.Name] = struct{}{}
+	}
+
+	var applied []config.MultiSelectFilter
+	multiSelect := append([]config.MultiSelectFilter{}, filters.MultiSelect...)
+	for _, f := range rw.Filters {
+		if _, ok := explicit[f.Name]; ok {
+			continue
+		}
+		multiSelect = append(multiSelect, f)
+		applied = append(applied, f)
+	}
+	rw.Filters = applied
+	filters.MultiSelect = multiSelect
+	rewritten.Filters = &filters
+	return &rewritten
+}
+
+// rewriteWords разбивает фразу на слова в нижнем регистре без знаков препинания по краям
+func rewriteWords(phrase string) []string {
+	fields := strings.Fields(strings.ToLower(phrase))
+	words := make([]string, 0, len(fields))
+	for _, f := range fields {
+		word := strings.TrimFunc(f, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+		if word != "" {
+			words = append(words, word)
+		}
+	}
+	return words
+}
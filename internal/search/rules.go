@@ -0,0 +1,161 @@
+package search
+
+import (
+	"fmt"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/query"
+	"searchengine/internal/common/request"
+	"searchengine/internal/rank"
+	"searchengine/internal/rules"
+	"sort"
+)
+
+// ruleStep - тип шага пересчета score бустом правила мерчандайзинга в объяснении
+const ruleStep = "rule"
+
+// hideDocs исключает из запроса документы, скрытые правилами. Пустой запрос - все документы
+func hideDocs(textQuery query.Query, actions *rules.Actions) query.Query {
+	if actions.Empty() || len(actions.Hide) == 0 {
+		return textQuery
+	}
+	if textQuery == nil {
+		textQuery = bleve.NewMatchAllQuery()
+	}
+	q := bleve.NewBooleanQuery()
+	q.AddMust(textQuery)
+	q.AddMustNot(bleve.NewDocIDQuery(actions.Hide))
+	return q
+}
+
+// boostByRules умножает score документов, подходящих под фильтры бустов правил, и пересортировывает документы.
+// С объяснением (explanations не nil) добавляет шаг в объяснение документа.
+func (sc *SearchClient) boostByRules(hits search.DocumentMatchCollection, boosts []rules.RuleBoost, profile *rank.Profile, explanations map[string]*rank.Explanation) error {
+	if len(boosts) == 0 || len(hits) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(hits))
+	byID := make(map[string]*search.DocumentMatch, len(hits))
+	for _, hit := range hits {
+		ids = append(ids, hit.ID)
+		byID[hit.ID] = hit
+	}
+
+	for _, b := range boosts {
+		matched, err := sc.matchFilters(ids, b.Filters)
+		if err != nil {
+			return fmt.Errorf("rule %s: %v", b.Rule, err)
+		}
+		for _, id := range matched {
+			hit := byID[id]
+			before := hit.Score
+			hit.Score *= b.Factor
+			if explanations == nil {
+				continue
+			}
+			e, ok := explanations[id]
+			if !ok {
+				e = profile.Explain(before)
+				explanations[id] = e
+			}
+			e.Steps = append(e.Steps, rank.Step{Type: ruleStep, Detail: fmt.Sprintf("%s: * %g", b.Rule, b.Factor), Before: before, After: hit.Score})
+		}
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	return nil
+}
+
+// matchFilters возвращает документы из ids, подходящие под фильтры
+func (sc *SearchClient) matchFilters(ids []string, filters *request.FilterRequest) ([]string, error) {
+	filtersQuery, err := sc.filterCli.ApplyFilters(filters)
+	if err != nil {
+		return nil, err
+	}
+	if filtersQuery == nil {
+		return ids, nil
+	}
+
+	searchRequest := bleve.NewSearchRequestOptions(bleve.NewConjunctionQuery(bleve.NewDocIDQuery(ids), filtersQuery), len(ids), 0, false)
+	result, err := sc.indxCli.Search(searchRequest)
+	if err != nil {
+		return nil, err
+	}
+	matched := make([]string, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		matched = append(matched, hit.ID)
+	}
+	return matched, nil
+}
+
+// pin закрепляет документы правил на позициях выдачи. Документ из окна выдачи переносится на позицию,
+// остальные загружаются из индекса, если подходят под фильтры запроса и не скрыты правилами, - и добавляются к total.
+// Возвращает закрепленные документы.
+func (sc *SearchClient) pin(result *bleve.SearchResult, actions *rules.Actions, combinedQuery query.Query, filters *request.FilterRequest, fields []string) (map[string]struct{}, error) {
+	pinned := make(map[string]struct{})
+	if len(actions.Pins) == 0 {
+		return pinned, nil
+	}
+	ids := make([]string, 0, len(actions.Pins))
+	for _, p := range actions.Pins {
+		ids = append(ids, p.ID)
+	}
+
+	// закрепленные документы без учета текста запроса
+	baseQuery, err := sc.filteredQuery(hideDocs(bleve.NewMatchAllQuery(), actions), filters)
+	if err != nil {
+		return nil, err
+	}
+	fetchRequest := bleve.NewSearchRequestOptions(bleve.NewConjunctionQuery(baseQuery, bleve.NewDocIDQuery(ids)), len(ids), 0, false)
+	fetchRequest.Fields = fields
+	fetched, err := sc.indxCli.Search(fetchRequest)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка загрузки закрепленных документов: %v", err)
+	}
+	if len(fetched.Hits) == 0 {
+		return pinned, nil
+	}
+
+	// сколько закрепленных документов и так подходят под запрос - они уже посчитаны в total
+	matchedRequest := bleve.NewSearchRequestOptions(bleve.NewConjunctionQuery(combinedQuery, bleve.NewDocIDQuery(ids)), 0, 0, false)
+	matched, err := sc.indxCli.Search(matchedRequest)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка загрузки закрепленных документов: %v", err)
+	}
+	result.Total += fetched.Total - matched.Total
+
+	// у документа вне выдачи нет релевантности запросу
+	docs := make(map[string]*search.DocumentMatch, len(fetched.Hits))
+	for _, hit := range fetched.Hits {
+		hit.Score = 0
+		docs[hit.ID] = hit
+	}
+	// документ из окна сохраняет score и позиции совпадений для подсветки
+	hits := make(search.DocumentMatchCollection, 0, len(result.Hits)+len(docs))
+	for _, hit := range result.Hits {
+		if _, ok := docs[hit.ID]; ok {
+			docs[hit.ID] = hit
+			continue
+		}
+		hits = append(hits, hit)
+	}
+
+	pins := append([]rules.Pin{}, actions.Pins...)
+	sort.SliceStable(pins, func(i, j int) bool { return pins[i].Position < pins[j].Position })
+	for _, p := range pins {
+		hit, ok := docs[p.ID]
+		if !ok {
+			continue
+		}
+		pos := min(p.Position-1, len(hits))
+		hits = append(hits[:pos], append(search.DocumentMatchCollection{hit}, hits[pos:]...)...)
+		pinned[p.ID] = struct{}{}
+	}
+	result.Hits = hits
+	return pinned, nil
+}
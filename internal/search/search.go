@@ -1,29 +1,60 @@
 package search
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/highlight"
+	"github.com/blevesearch/bleve/v2/search/query"
 	"searchengine/internal/common/request"
+	"searchengine/internal/experiment"
 	"searchengine/internal/filter"
 	"searchengine/internal/index"
 	"searchengine/internal/rank"
+	"searchengine/internal/rules"
+	"searchengine/internal/spell"
+	"slices"
+	"strconv"
 	"strings"
 )
 
+// defaultFuzziness - допустимое число правок в слове запроса, если fuzziness не задан
+const defaultFuzziness = 1
+
+// Операторы между словами запроса
+const (
+	OperatorAnd = "and"
+	OperatorOr  = "or"
+)
+
 type SearchClient struct {
 	indxCli   *index.Index
 	RankCli   *rank.RankingClient
 	filterCli *filter.FilterClient
+	spellCli  *spell.SpellClient
+	rulesCli  *rules.RulesClient
+	Rewriter  *Rewriter
 }
 
-func NewSearchClient(indxCli *index.Index, rankCli *rank.RankingClient, filterCli *filter.FilterClient) *SearchClient {
+func NewSearchClient(indxCli *index.Index, rankCli *rank.RankingClient, filterCli *filter.FilterClient, spellCli *spell.SpellClient, rulesCli *rules.RulesClient, rewriter *Rewriter) *SearchClient {
 	return &SearchClient{
 		indxCli:   indxCli,
 		RankCli:   rankCli,
 		filterCli: filterCli,
+		spellCli:  spellCli,
+		rulesCli:  rulesCli,
+		Rewriter:  rewriter,
 	}
 }
 
+// WithRanking возвращает клиент поиска по тому же индексу с другим клиентом ранжирования
+func (sc *SearchClient) WithRanking(rankCli *rank.RankingClient) *SearchClient {
+	c := *sc
+	c.RankCli = rankCli
+	return &c
+}
+
 // SearchIndex выполняет поиск в индексе по заданным параметрам //todo
 func (sc *SearchClient) SearchIndex(queryText string, filters map[string]interface{}, sortFields []string) ([]map[string]interface{}, error) {
 	// Создаем базовый запрос для полнотекстового поиска
@@ -111,55 +142,652 @@ func (sc *SearchClient) SearchIndex(queryText string, filters map[string]interfa
 //	return results, nil
 //}
 
-func (sc *SearchClient) AdvancedSearch(queryText string, filters *request.FilterRequest, sortField string, sortOrder string) ([]map[string]interface{}, error) {
-	// Разделяем запрос на отдельные термины
-	terms := strings.Fields(queryText)
-	booleanQuery := bleve.NewBooleanQuery()
+// SearchResult - ответ поиска с пагинацией
+type SearchResult struct {
+	Total    uint64                   `json:"total"`
+	Took     int64                    `json:"took"` // мс
+	MaxScore float64                  `json:"max_score"`
+	Hits     []map[string]interface{} `json:"hits"`
+
+	// NextCursor - курсор следующей страницы, пустой если документы закончились
+	NextCursor string `json:"next_cursor,omitempty"`
+
+	// Facets - количество документов по значениям фильтров, если запрошено
+	Facets []filter.Facet `json:"facets,omitempty"`
+
+	// Query - исходный запрос, CorrectedQuery - запрос с исправленными опечатками, если исходный ничего не нашел
+	Query          string `json:"query,omitempty"`
+	CorrectedQuery string `json:"corrected_query,omitempty"`
+	// Corrected - выдача получена по исправленному запросу
+	Corrected bool `json:"corrected,omitempty"`
+
+	// RankProfile - профиль ранжирования, по которому упорядочена выдача
+	RankProfile string `json:"rank_profile,omitempty"`
+
+	// Experiments - варианты A/B экспериментов, назначенные запросу
+	Experiments []experiment.Assignment `json:"experiments,omitempty"`
+
+	// Rules - id правил мерчандайзинга, сработавших на запрос
+	Rules []string `json:"rules,omitempty"`
+
+	// Rewrite - как запрос был переписан перед поиском: стоп-слова, замены, фильтры из фраз
+	Rewrite *Rewrite `json:"rewrite,omitempty"`
+	// Intent - фильтры, найденные в запросе (intent=true)
+	Intent *Intent `json:"intent,omitempty"`
 
-	// Добавляем каждый термин как отдельный MatchQuery с Fuzzy
-	for _, term := range terms {
-		termQuery := bleve.NewMatchQuery(term)
-		termQuery.Fuzziness = 1
-		booleanQuery.AddShould(termQuery) // Используем Should для логического OR
+	// SimilarTerms - термины исходного документа, по которым искались похожие (/similar)
+	SimilarTerms []SimilarTerm `json:"similar_terms,omitempty"`
+}
+
+// AdvancedSearch переписывает запрос по правилам, с Intent выделяет из него фильтры и выполняет поиск;
+// если ничего не найдено - предлагает исправленный запрос, а с AutoCorrect сразу ищет по нему
+func (sc *SearchClient) AdvancedSearch(req *request.SearchRequest) (*SearchResult, error) {
+	original := req.Query
+	req, rewrite := sc.rewrite(req)
+	req, intent := sc.extractIntent(req)
+
+	result, err := sc.execute(req)
+	if err != nil {
+		return nil, err
 	}
+	result.Query = original
+	result.Rewrite = rewrite
+	result.Intent = intent
 
-	// Применяем фильтры
-	filtersQuery, err := sc.filterCli.ApplyFilters(filters)
+	// Курсор получен для выдачи исходного запроса, исправлять нечего
+	if result.Total > 0 || req.Cursor != "" || sc.spellCli == nil || strings.TrimSpace(req.Query) == "" {
+		return result, nil
+	}
+	// Запрос с синтаксисом (фразы, поля, исключения) не исправляем, чтобы не сломать его
+	groups, _ := parseQueryString(req.Query, sc.indxCli.ICfg)
+	for _, group := range groups {
+		if len(group) != 1 || !group[0].plain() {
+			return result, nil
+		}
+	}
+
+	corrected, ok, err := sc.spellCli.Correct(req.Query)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка применения фильтров: %v", err)
+		return nil, err
+	}
+	if !ok {
+		return result, nil
+	}
+	result.CorrectedQuery = corrected
+	if !req.AutoCorrect {
+		return result, nil
 	}
 
-	// Комбинируем поиск и фильтры
-	combinedQuery := bleve.NewBooleanQuery()
-	if len(terms) > 0 {
-		combinedQuery.AddMust(booleanQuery)
+	correctedReq := *req
+	correctedReq.Query = corrected
+	correctedResult, err := sc.execute(&correctedReq)
+	if err != nil {
+		return nil, err
 	}
-	if filtersQuery != nil {
-		combinedQuery.AddMust(filtersQuery)
+	if correctedResult.Total == 0 {
+		return result, nil
 	}
+	correctedResult.Query = original
+	correctedResult.Rewrite = rewrite
+	correctedResult.Intent = intent
+	correctedResult.CorrectedQuery = corrected
+	correctedResult.Corrected = true
+	return correctedResult, nil
+}
 
-	searchRequest := bleve.NewSearchRequest(combinedQuery)
+// rewrite переписывает запрос из обычных слов; запрос с синтаксисом (фразы, поля, исключения) не меняется.
+// Возвращает параметры поиска по переписанному запросу или исходные, если переписывать нечего.
+func (sc *SearchClient) rewrite(req *request.SearchRequest) (*request.SearchRequest, *Rewrite) {
+	if sc.Rewriter == nil {
+		return req, nil
+	}
+	if !plainQuery(req.Query, sc.indxCli.ICfg) {
+		return req, nil
+	}
+
+	rewrite := sc.Rewriter.Rewrite(req.Query)
+	if rewrite == nil {
+		return req, nil
+	}
+	rewritten := applyRewrite(req, rewrite)
+	// все фильтры из запроса уже выбраны явно, а других слов в запросе нет
+	if rewritten.Query == "" && len(rewrite.Filters) == 0 {
+		return req, nil
+	}
+	return rewritten, rewrite
+}
+
+// execute выполняет поисковый запрос как есть, с правилами мерчандайзинга, сработавшими на запрос
+func (sc *SearchClient) execute(req *request.SearchRequest) (*SearchResult, error) {
+	profile, err := sc.rankProfile(req)
+	if err != nil {
+		return nil, err
+	}
+	textQuery, err := sc.textQuery(req, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	var actions *rules.Actions
+	if sc.rulesCli != nil {
+		category := ""
+		if req.Filters != nil {
+			category = req.Filters.Category
+		}
+		actions = sc.rulesCli.Match(req.Query, category)
+	}
+	return sc.run(textQuery, req, profile, actions)
+}
+
+// Query выполняет поиск по запросу из JSON DSL (POST /query)
+func (sc *SearchClient) Query(dsl json.RawMessage, req *request.SearchRequest) (*SearchResult, error) {
+	profile, err := sc.rankProfile(req)
+	if err != nil {
+		return nil, err
+	}
+	q, err := sc.CompileDSL(dsl)
+	if err != nil {
+		return nil, err
+	}
+	return sc.run(q, req, profile, nil)
+}
+
+// rankProfile выбирает профиль ранжирования: из запроса или по категории фильтра
+func (sc *SearchClient) rankProfile(req *request.SearchRequest) (*rank.Profile, error) {
+	category := ""
+	if req.Filters != nil {
+		category = req.Filters.Category
+	}
+	return sc.RankCli.Profile(req.RankProfile, category)
+}
+
+// run выполняет поиск по готовому запросу с фильтрами, сортировкой, пагинацией, фасетами и подсветкой.
+// actions - действия правил мерчандайзинга, nil - правил нет
+func (sc *SearchClient) run(textQuery query.Query, req *request.SearchRequest, profile *rank.Profile, actions *rules.Actions) (*SearchResult, error) {
+	// скрытые правилами документы исключаются из запроса - и из выдачи, и из количества, и из фасетов
+	textQuery = hideDocs(textQuery, actions)
+	combinedQuery, err := sc.filteredQuery(textQuery, req.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	searchRequest := bleve.NewSearchRequestOptions(combinedQuery, req.Size, req.From, false)
 	searchRequest.Fields = []string{"*"}
+	if len(req.Fields) > 0 {
+		searchRequest.Fields = req.Fields
+	}
+
+	searchRequest.Explain = req.Explain
+
+	var highlighter highlight.Highlighter
+	if req.Highlight != nil {
+		highlighter, err = newHighlighter(req.Highlight)
+		if err != nil {
+			return nil, err
+		}
+		// позиции терминов нужны подсветке для выбора фрагментов
+		searchRequest.IncludeLocations = true
+	}
 
 	// Применяем сортировку
-	if err := sc.RankCli.ApplyRanking(searchRequest, sortField, sortOrder); err != nil {
+	if err := sc.RankCli.ApplyRanking(searchRequest, req.SortField, req.SortOrder); err != nil {
 		return nil, fmt.Errorf("ошибка сортировки: %v", err)
 	}
 
+	var facetQueries []filter.FacetQuery
+	if req.Facets {
+		facetQueries, err = sc.filterCli.FacetQueries(req.Filters)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка построения фасетов: %v", err)
+		}
+		// фасеты невыбранных фильтров считаются основным запросом
+		searchRequest.Facets = facetQueries[0].Facets
+	}
+
+	// При сортировке по релевантности лучшие документы пересчитываются функциями ранжирования из конфига
+	rescore := req.SortField == "" && profile.HasRescorers()
+	// закрепление и бусты правил переставляют документы, поэтому, как и пересчет, работают на окне лучших документов
+	merchandise := !actions.Empty() && (len(actions.Pins) > 0 || len(actions.Boosts) > 0 && req.SortField == "")
+	if rescore && req.Cursor != "" {
+		return nil, fmt.Errorf("%w: cursor can't be used with rescoring boosts, use from/size or sortField", index.ErrInvalidCursor)
+	}
+	if merchandise && req.Cursor != "" {
+		return nil, fmt.Errorf("%w: cursor can't be used with pinning and boosting rules", index.ErrInvalidCursor)
+	}
+	if rescore || merchandise {
+		searchRequest.From = 0
+		searchRequest.Size = max(profile.RescoreWindow(), req.From+req.Size)
+	}
+	var extraFields []string
+	if rescore {
+		if profile.NeedsLocations() {
+			searchRequest.IncludeLocations = true
+		}
+		if len(req.Fields) > 0 {
+			for _, f := range profile.RescoreFields() {
+				if !slices.Contains(searchRequest.Fields, f) {
+					searchRequest.Fields = append(searchRequest.Fields, f)
+					extraFields = append(extraFields, f)
+				}
+			}
+		}
+	}
+
+	if req.Cursor != "" {
+		err = index.ApplyCursor(searchRequest, req.Cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Выполняем поиск
 	searchResult, err := sc.indxCli.Search(searchRequest)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка поиска: %v", err)
 	}
 
+	var rankExplanations map[string]*rank.Explanation
+	if rescore {
+		rankExplanations = profile.Rescore(searchResult.Hits, req.Explain)
+	}
+	var pinned map[string]struct{}
+	if merchandise {
+		if req.Explain && rankExplanations == nil {
+			rankExplanations = make(map[string]*rank.Explanation)
+		}
+		if req.SortField == "" {
+			err = sc.boostByRules(searchResult.Hits, actions.Boosts, profile, rankExplanations)
+			if err != nil {
+				return nil, err
+			}
+		}
+		pinned, err = sc.pin(searchResult, actions, combinedQuery, req.Filters, searchRequest.Fields)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if rescore || merchandise {
+		searchResult.Hits = searchResult.Hits[min(req.From, len(searchResult.Hits)):min(req.From+req.Size, len(searchResult.Hits))]
+		searchResult.MaxScore = 0
+		for _, hit := range searchResult.Hits {
+			searchResult.MaxScore = max(searchResult.MaxScore, hit.Score)
+		}
+	}
+
 	// Формируем результаты
 	results := make([]map[string]interface{}, 0, len(searchResult.Hits))
 	for _, hit := range searchResult.Hits {
-		results = append(results, map[string]interface{}{
+		for _, field := range req.ExcludeFields {
+			delete(hit.Fields, field)
+		}
+		for _, field := range extraFields {
+			delete(hit.Fields, field)
+		}
+		res := map[string]interface{}{
 			"id":     hit.ID,
 			"score":  hit.Score,
 			"fields": hit.Fields,
-		})
+		}
+		if _, ok := pinned[hit.ID]; ok {
+			res["pinned"] = true
+		}
+		if highlighter != nil {
+			res["highlight"], err = sc.highlightHit(highlighter, req.Highlight, hit)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if req.Explain {
+			rankExpl, ok := rankExplanations[hit.ID]
+			if !ok {
+				rankExpl = profile.Explain(hit.Score)
+			}
+			res["explanation"] = &HitExplanation{Bleve: hit.Expl, Rank: rankExpl}
+		}
+		results = append(results, res)
 	}
-	return results, nil
+	result := &SearchResult{
+		Total:    searchResult.Total,
+		Took:     searchResult.Took.Milliseconds(),
+		MaxScore: searchResult.MaxScore,
+		Hits:     results,
+
+		RankProfile: profile.Name,
+	}
+	if !actions.Empty() {
+		result.Rules = actions.Rules
+	}
+	// после пересчета и правил порядок не совпадает с сортировкой индекса, курсор по нему не построить
+	if len(searchResult.Hits) == req.Size && !rescore && !merchandise {
+		result.NextCursor, err = index.EncodeCursor(searchRequest.Sort, searchResult.Hits[len(searchResult.Hits)-1])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if req.Facets {
+		result.Facets, err = sc.facets(textQuery, req.Filters, facetQueries, searchResult)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// fuzziness - допустимое число правок в словах запроса
+func fuzziness(req *request.SearchRequest) int {
+	if req.Fuzziness != nil {
+		return *req.Fuzziness
+	}
+	return defaultFuzziness
+}
+
+// textQuery строит полнотекстовую часть запроса по строке запроса (см. parseQueryString), nil - если запрос пустой.
+// Обычные слова ищутся по полям SearchFields (по умолчанию - по всем) и соединяются по Operator и MinimumShouldMatch.
+func (sc *SearchClient) textQuery(req *request.SearchRequest, profile *rank.Profile) (query.Query, error) {
+	groups, err := parseQueryString(req.Query, sc.indxCli.ICfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return nil, nil
+	}
+
+	fuzziness := fuzziness(req)
+	fields := req.SearchFields
+	// слова считаются по отдельности, только если задано, сколько их должно совпасть
+	countWords := req.Operator == OperatorAnd || req.MinimumShouldMatch != ""
+	var words []query.Query
+
+	booleanQuery := bleve.NewBooleanQuery()
+	positive := false
+	for _, group := range groups {
+		// Обычные слова - Should для логического OR
+		if len(group) == 1 && group[0].plain() {
+			termQueries, err := sc.termQueries(group[0].Value, fuzziness, profile, fields)
+			if err != nil {
+				return nil, err
+			}
+			if countWords {
+				words = append(words, bleve.NewDisjunctionQuery(termQueries...))
+			} else {
+				booleanQuery.AddShould(termQueries...)
+			}
+			positive = true
+			continue
+		}
+		if len(group) == 1 && group[0].Negate {
+			booleanQuery.AddMustNot(clauseQuery(group[0], sc.indxCli.ICfg))
+			continue
+		}
+
+		// Фраза, поле:значение, шаблон или группа OR обязательны
+		alternatives := make([]query.Query, 0, len(group))
+		for _, c := range group {
+			if c.Phrase && c.Field == "" {
+				phrase := c.Value
+				alternatives = append(alternatives, sc.boosted(profile, fields, clauseQuery(c, sc.indxCli.ICfg), func(field string) query.Query {
+					fieldQuery := bleve.NewMatchPhraseQuery(phrase)
+					fieldQuery.SetField(field)
+					return fieldQuery
+				}))
+				continue
+			}
+			if !c.plain() {
+				alternatives = append(alternatives, clauseQuery(c, sc.indxCli.ICfg))
+				continue
+			}
+			termQueries, err := sc.termQueries(c.Value, fuzziness, profile, fields)
+			if err != nil {
+				return nil, err
+			}
+			alternatives = append(alternatives, bleve.NewDisjunctionQuery(termQueries...))
+		}
+		if len(alternatives) == 1 {
+			booleanQuery.AddMust(alternatives[0])
+		} else {
+			booleanQuery.AddMust(bleve.NewDisjunctionQuery(alternatives...))
+		}
+		positive = true
+	}
+
+	if len(words) > 0 {
+		required := len(words)
+		if req.Operator != OperatorAnd {
+			required, err = MinimumShouldMatch(req.MinimumShouldMatch, len(words))
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+			}
+		}
+		if required >= len(words) {
+			booleanQuery.AddMust(words...)
+		} else {
+			booleanQuery.AddShould(words...)
+			booleanQuery.SetMinShould(float64(required))
+		}
+	}
+
+	// Запрос только из исключений: исключаем из всех документов
+	if !positive {
+		booleanQuery.AddMust(bleve.NewMatchAllQuery())
+	}
+	return booleanQuery, nil
+}
+
+// termQueries строит запросы для обычного слова: нечеткий поиск, синонимы, другая раскладка.
+// fields - поля поиска с весами, пусто - все поля
+func (sc *SearchClient) termQueries(term string, fuzziness int, profile *rank.Profile, fields []request.FieldWeight) ([]query.Query, error) {
+	queries := make([]query.Query, 0)
+
+	termQuery := bleve.NewMatchQuery(term)
+	termQuery.Fuzziness = fuzziness
+	queries = append(queries, sc.boosted(profile, fields, termQuery, func(field string) query.Query {
+		fieldQuery := bleve.NewMatchQuery(term)
+		fieldQuery.Fuzziness = fuzziness
+		fieldQuery.SetField(field)
+		return fieldQuery
+	}))
+
+	// Синонимы раскрываются только при поиске по полю с источником синонимов, поэтому ищем по ним явно
+	for _, field := range sc.synonymFields() {
+		weight, ok := fieldWeight(fields, field)
+		if !ok {
+			continue
+		}
+		synQuery := bleve.NewMatchQuery(term)
+		synQuery.SetField(field)
+		if len(fields) > 0 {
+			synQuery.SetBoost(weight)
+		}
+		queries = append(queries, synQuery)
+	}
+
+	// Слово, набранное в другой раскладке или транслитом, ищем с меньшим весом
+	if sc.indxCli.ICfg.LayoutFix {
+		variants, err := sc.layoutVariants(term)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range variants {
+			if len(fields) == 0 {
+				variantQuery := bleve.NewMatchQuery(v)
+				variantQuery.SetBoost(variantBoost)
+				queries = append(queries, variantQuery)
+				continue
+			}
+			for _, f := range fields {
+				variantQuery := bleve.NewMatchQuery(v)
+				variantQuery.SetField(f.Field)
+				variantQuery.SetBoost(variantBoost * f.Weight)
+				queries = append(queries, variantQuery)
+			}
+		}
+	}
+	return queries, nil
+}
+
+// fieldWeight - вес поля среди полей поиска; без полей поиска ищется по всем полям с весом 1
+func fieldWeight(fields []request.FieldWeight, field string) (float64, bool) {
+	if len(fields) == 0 {
+		return 1, true
+	}
+	for _, f := range fields {
+		if f.Field == field {
+			return f.Weight, true
+		}
+	}
+	return 0, false
+}
+
+// boosted объединяет запрос по всем полям с запросами по полям с весами из профиля ранжирования.
+// Дизъюнкция суммирует вклад совпавших запросов, поэтому совпадение в поле с большим весом поднимает документ выше.
+// С полями поиска (fields) запрос строится только по ним с их весами вместо запроса по всем полям и весов профиля.
+func (sc *SearchClient) boosted(profile *rank.Profile, fields []request.FieldWeight, base query.Query, fieldQuery func(field string) query.Query) query.Query {
+	if len(fields) > 0 {
+		clauses := make([]query.Query, 0, len(fields))
+		for _, f := range fields {
+			q := fieldQuery(f.Field)
+			q.(query.BoostableQuery).SetBoost(f.Weight)
+			clauses = append(clauses, q)
+		}
+		if len(clauses) == 1 {
+			return clauses[0]
+		}
+		return bleve.NewDisjunctionQuery(clauses...)
+	}
+
+	clauses := []query.Query{base}
+	for _, b := range profile.FieldBoosts() {
+		if !sc.isTextField(b.Field) {
+			continue
+		}
+		q := fieldQuery(b.Field)
+		q.(query.BoostableQuery).SetBoost(b.Boost)
+		clauses = append(clauses, q)
+	}
+	if len(clauses) == 1 {
+		return base
+	}
+	return bleve.NewDisjunctionQuery(clauses...)
+}
+
+// isTextField сообщает, что поле searchable и текстовое - по нему можно бустить совпадения
+func (sc *SearchClient) isTextField(name string) bool {
+	for _, f := range sc.indxCli.ICfg.Fields {
+		if f.Name == name {
+			return f.Searchable && (f.Type == "string" || f.Type == "keyword")
+		}
+	}
+	return false
+}
+
+// layoutVariants возвращает формы слова в другой раскладке и транслитерации, которые есть в словаре индекса.
+// Если само слово есть в словаре - оно набрано правильно и вариантов нет.
+// Индекс, построенный до появления поля словаря, словаря не имеет - тогда варианты не проверяются.
+func (sc *SearchClient) layoutVariants(term string) ([]string, error) {
+	variants := termVariants(term)
+	if sc.spellCli == nil || len(variants) == 0 {
+		return variants, nil
+	}
+
+	empty, err := sc.spellCli.Empty()
+	if err != nil || empty {
+		return variants, err
+	}
+
+	known, err := sc.spellCli.Known(strings.ToLower(term))
+	if err != nil || known {
+		return nil, err
+	}
+
+	res := make([]string, 0, len(variants))
+	for _, v := range variants {
+		known, err = sc.spellCli.Known(v)
+		if err != nil {
+			return nil, err
+		}
+		if known {
+			res = append(res, v)
+		}
+	}
+	return res, nil
+}
+
+// filteredQuery комбинирует полнотекстовый запрос и фильтры
+func (sc *SearchClient) filteredQuery(textQuery query.Query, filters *request.FilterRequest) (query.Query, error) {
+	filtersQuery, err := sc.filterCli.ApplyFilters(filters)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка применения фильтров: %v", err)
+	}
+
+	combinedQuery := bleve.NewBooleanQuery()
+	if textQuery != nil {
+		combinedQuery.AddMust(textQuery)
+	}
+	if filtersQuery != nil {
+		combinedQuery.AddMust(filtersQuery)
+	}
+	return combinedQuery, nil
+}
+
+// facets досчитывает фасеты выбранных фильтров отдельными запросами без самого фильтра
+// и собирает ответ вместе с фасетами основного запроса
+func (sc *SearchClient) facets(textQuery query.Query, filters *request.FilterRequest, facetQueries []filter.FacetQuery, mainResult *bleve.SearchResult) ([]filter.Facet, error) {
+	results := search.FacetResults{}
+	for name, fr := range mainResult.Facets {
+		results[name] = fr
+	}
+
+	for _, fq := range facetQueries[1:] {
+		q, err := sc.filteredQuery(textQuery, fq.Filters)
+		if err != nil {
+			return nil, err
+		}
+		facetRequest := bleve.NewSearchRequestOptions(q, 0, 0, false)
+		facetRequest.Facets = fq.Facets
+
+		res, err := sc.indxCli.Search(facetRequest)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка подсчета фасета %s: %v", fq.Exclude, err)
+		}
+		for name, fr := range res.Facets {
+			results[name] = fr
+		}
+	}
+
+	return sc.filterCli.BuildFacets(filters, results)
+}
+
+// synonymFields возвращает текстовые поля индекса, для которых включены синонимы
+func (sc *SearchClient) synonymFields() []string {
+	fields := make([]string, 0)
+	for _, f := range sc.indxCli.ICfg.Fields {
+		if f.Synonym && f.Searchable && f.Type == "string" {
+			fields = append(fields, f.Name)
+		}
+	}
+	return fields
+}
+
+// MinimumShouldMatch возвращает, сколько из n слов запроса должно совпасть:
+// "2" - два слова, "-1" - все кроме одного, "75%" - 75% слов с округлением вниз, "-25%" - все кроме 25%.
+// Пусто - хотя бы одно слово. Результат не меньше 1 и не больше n.
+func MinimumShouldMatch(spec string, n int) (int, error) {
+	if spec == "" {
+		return min(1, n), nil
+	}
+
+	value, percent := strings.CutSuffix(spec, "%")
+	v, err := strconv.Atoi(value)
+	if err != nil || percent && (v < -100 || v > 100) {
+		return 0, fmt.Errorf("invalid minimum_should_match: %s", spec)
+	}
+	required := v
+	if percent {
+		required = n * v / 100
+	}
+	if v < 0 {
+		required = n + required
+	}
+	return max(1, min(required, n)), nil
 }
@@ -0,0 +1,94 @@
+package search
+
+import (
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+	"os"
+	"searchengine/internal/common/request"
+	"searchengine/internal/config"
+	"searchengine/internal/filter"
+	"searchengine/internal/index"
+	"searchengine/internal/rank"
+	"strings"
+	"testing"
+)
+
+// newTestClient - поисковый клиент над индексом во временной папке: три товара и словарь синонимов
+func newTestClient(t *testing.T) *SearchClient {
+	t.Helper()
+
+	dir, err := os.MkdirTemp("", "search-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// bleve дописывает файлы индекса в фоне, поэтому папка удаляется без проверки, в отличие от t.TempDir
+	t.Cleanup(func() {
+		_ = os.RemoveAll(dir)
+	})
+
+	cfg := &config.Config{
+		IndexPath: dir + "/",
+		IndexCfg: &config.IndexConfig{
+			IndexName: "test",
+			Fields: []config.FieldConfig{
+				{Name: "title", Type: "string", Searchable: true, Synonym: true},
+				{Name: "brand", Type: "keyword", Searchable: true, Filterable: true},
+				{Name: "price", Type: "number", Filterable: true, Sortable: true},
+				{Name: "rating", Type: "number", Filterable: true},
+			},
+		},
+		SynonymCfg: []config.SynonymRule{
+			{ID: "sneakers", Type: config.SynonymEquivalent, Synonyms: []string{"кроссовки", "кеды"}},
+			{ID: "hats", Type: config.SynonymEquivalent, Synonyms: []string{"кепка", "бейсболка"}},
+		},
+	}
+	idx := index.New(cfg)
+	if !idx.SupportsSynonyms() {
+		t.Fatal("test index must support synonyms")
+	}
+
+	docs := map[string]map[string]interface{}{
+		"1": {"title": "кроссовки беговые", "brand": "nike", "price": 4500.0, "rating": 4.5},
+		"2": {"title": "кеды летние", "brand": "adidas", "price": 3000.0, "rating": 4.8},
+		"3": {"title": "кепка хлопковая", "brand": "puma", "price": 900.0, "rating": 3.9},
+	}
+	for id, doc := range docs {
+		err = idx.AddDocument(id, doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return &SearchClient{indxCli: idx, filterCli: filter.New(cfg)}
+}
+
+// searchIDs выполняет запрос через индекс и проверяет, что правила синонимов не попали в выдачу
+func searchIDs(t *testing.T, sc *SearchClient, q query.Query) (uint64, []string) {
+	t.Helper()
+
+	res, err := sc.indxCli.Search(bleve.NewSearchRequestOptions(q, 100, 0, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, 0, len(res.Hits))
+	for _, hit := range res.Hits {
+		if strings.HasPrefix(hit.ID, "_synonym_") {
+			t.Errorf("synonym rule %s in hits", hit.ID)
+		}
+		ids = append(ids, hit.ID)
+	}
+	return res.Total, ids
+}
+
+func TestExclusionOnlyQuerySkipsSynonymRules(t *testing.T) {
+	sc := newTestClient(t)
+
+	q, err := sc.textQuery(&request.SearchRequest{Query: "-кепка"}, &rank.Profile{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	total, ids := searchIDs(t, sc, q)
+	if total != 2 || len(ids) != 2 {
+		t.Errorf("total = %d, hits = %v, want documents 1 and 2", total, ids)
+	}
+}
@@ -0,0 +1,138 @@
+package search
+
+import (
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+	indexapi "github.com/blevesearch/bleve_index_api"
+	"math"
+	"searchengine/internal/common/request"
+	"sort"
+)
+
+const (
+	// similarMaxTerms - сколько самых значимых терминов документа попадает в запрос похожих
+	similarMaxTerms = 25
+	// similarMinDocFreq - термин должен встречаться хотя бы в одном документе кроме исходного
+	similarMinDocFreq = 2
+)
+
+// similarKey - термин поля
+type similarKey struct {
+	field string
+	term  string
+}
+
+// SimilarTerm - значимый термин исходного документа и его вес в запросе похожих (tf-idf)
+type SimilarTerm struct {
+	Field  string  `json:"field"`
+	Term   string  `json:"term"`
+	Weight float64 `json:"weight"`
+}
+
+// Similar ищет документы, похожие на doc: значимые по tf-idf термины searchable полей документа
+// становятся взвешенным запросом, сам документ исключается. sameCategory - только документы той же категории.
+// Остальные параметры выдачи (фильтры, пагинация, поля, профиль ранжирования) - как у /search.
+// Термины берутся из сохраненных значений: VisitFields видит только поля со Store, а маппинг индекса
+// хранит все поля конфига (см. index.newFieldMapping).
+func (sc *SearchClient) Similar(doc indexapi.Document, sameCategory bool, req *request.SearchRequest) (*SearchResult, error) {
+	searchable := make(map[string]struct{})
+	for _, f := range sc.indxCli.ICfg.Fields {
+		if f.Searchable && (f.Type == "string" || f.Type == "keyword") {
+			searchable[f.Name] = struct{}{}
+		}
+	}
+	values := make(map[string][]string)
+	category := ""
+	doc.VisitFields(func(f indexapi.Field) {
+		if f.Name() == "category" {
+			category = string(f.Value())
+		}
+		if _, ok := searchable[f.Name()]; ok {
+			values[f.Name()] = append(values[f.Name()], string(f.Value()))
+		}
+	})
+
+	if sameCategory && category != "" {
+		filters := request.FilterRequest{}
+		if req.Filters != nil {
+			filters = *req.Filters
+		}
+		filters.Category = category
+		similarReq := *req
+		similarReq.Filters = &filters
+		req = &similarReq
+	}
+
+	terms, err := sc.significantTerms(values)
+	if err != nil {
+		return nil, err
+	}
+
+	var similarQuery query.Query = bleve.NewMatchNoneQuery()
+	if len(terms) > 0 {
+		termQueries := make([]query.Query, 0, len(terms))
+		for _, t := range terms {
+			q := bleve.NewTermQuery(t.Term)
+			q.SetField(t.Field)
+			q.SetBoost(t.Weight)
+			termQueries = append(termQueries, q)
+		}
+		bq := bleve.NewBooleanQuery()
+		bq.AddMust(bleve.NewDisjunctionQuery(termQueries...))
+		bq.AddMustNot(bleve.NewDocIDQuery([]string{doc.ID()}))
+		similarQuery = bq
+	}
+
+	profile, err := sc.rankProfile(req)
+	if err != nil {
+		return nil, err
+	}
+	result, err := sc.run(similarQuery, req, profile, nil)
+	if err != nil {
+		return nil, err
+	}
+	result.SimilarTerms = terms
+	return result, nil
+}
+
+// significantTerms выбирает самые значимые термины значений полей: вес - частота термина в документе,
+// умноженная на idf по индексу. Термины, которых нет в других документах, не выбираются - по ним ничего не найти.
+func (sc *SearchClient) significantTerms(values map[string][]string) ([]SimilarTerm, error) {
+	freqs := make(map[similarKey]int)
+	docFreqs := make(map[similarKey]uint64)
+	var docCount uint64
+	for field, vals := range values {
+		for _, v := range vals {
+			stats, n, err := sc.indxCli.TermStats(field, v)
+			if err != nil {
+				return nil, err
+			}
+			docCount = max(docCount, n)
+			for _, st := range stats {
+				key := similarKey{field: field, term: st.Term}
+				freqs[key] += st.Freq
+				docFreqs[key] = st.DocFreq
+			}
+		}
+	}
+
+	terms := make([]SimilarTerm, 0, len(freqs))
+	for key, freq := range freqs {
+		df := docFreqs[key]
+		if df < similarMinDocFreq {
+			continue
+		}
+		idf := 1 + math.Log(float64(docCount)/float64(df))
+		terms = append(terms, SimilarTerm{Field: key.field, Term: key.term, Weight: float64(freq) * idf})
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if terms[i].Weight != terms[j].Weight {
+			return terms[i].Weight > terms[j].Weight
+		}
+		if terms[i].Field != terms[j].Field {
+			return terms[i].Field < terms[j].Field
+		}
+		return terms[i].Term < terms[j].Term
+	})
+	return terms[:min(len(terms), similarMaxTerms)], nil
+}
@@ -0,0 +1,117 @@
+package search
+
+import (
+	"fmt"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+	"searchengine/internal/common/request"
+	"searchengine/internal/index"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Suggestion - подсказка автодополнения: значение поля и количество документов с ним
+type Suggestion struct {
+	Text  string `json:"text"`
+	Field string `json:"field"`
+	Count int    `json:"count"`
+}
+
+// SuggestResult - ответ автодополнения
+type SuggestResult struct {
+	Took        int64        `json:"took"` // мс
+	Suggestions []Suggestion `json:"suggestions"`
+}
+
+// Suggest возвращает значения suggest полей, слова которых начинаются со слов запроса.
+// Одинаковые без учета регистра значения разных полей схлопываются в одну подсказку.
+func (sc *SearchClient) Suggest(req *request.SuggestRequest) (*SuggestResult, error) {
+	t := time.Now()
+	result := &SuggestResult{Suggestions: make([]Suggestion, 0)}
+
+	prefixes := suggestPrefixes(req.Query)
+	if len(prefixes) == 0 {
+		return result, nil
+	}
+
+	filtersQuery, err := sc.filterCli.ApplyFilters(req.Filters)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка применения фильтров: %v", err)
+	}
+
+	byText := make(map[string]Suggestion)
+	for _, f := range sc.indxCli.ICfg.Fields {
+		if !f.Suggest {
+			continue
+		}
+
+		// Каждое слово запроса - префикс какого-то слова значения
+		prefixQueries := make([]query.Query, 0, len(prefixes)+1)
+		for _, p := range prefixes {
+			tq := bleve.NewTermQuery(p)
+			tq.SetField(index.SuggestField(f.Name))
+			prefixQueries = append(prefixQueries, tq)
+		}
+		if filtersQuery != nil {
+			prefixQueries = append(prefixQueries, filtersQuery)
+		}
+
+		searchRequest := bleve.NewSearchRequestOptions(bleve.NewConjunctionQuery(prefixQueries...), 0, 0, false)
+		searchRequest.AddFacet(f.Name, bleve.NewFacetRequest(index.SuggestRawField(f.Name), req.Size))
+
+		res, err := sc.indxCli.Search(searchRequest)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка поиска подсказок: %v", err)
+		}
+
+		facet, ok := res.Facets[f.Name]
+		if !ok {
+			continue
+		}
+		for _, term := range facet.Terms.Terms() {
+			key := strings.ToLower(term.Term)
+			if s, ok := byText[key]; ok && s.Count >= term.Count {
+				continue
+			}
+			byText[key] = Suggestion{Text: term.Term, Field: f.Name, Count: term.Count}
+		}
+	}
+
+	for _, s := range byText {
+		result.Suggestions = append(result.Suggestions, s)
+	}
+	// Сначала частые, затем короткие подсказки
+	sort.Slice(result.Suggestions, func(i, j int) bool {
+		a, b := result.Suggestions[i], result.Suggestions[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if len(a.Text) != len(b.Text) {
+			return len(a.Text) < len(b.Text)
+		}
+		return a.Text < b.Text
+	})
+	if len(result.Suggestions) > req.Size {
+		result.Suggestions = result.Suggestions[:req.Size]
+	}
+
+	result.Took = time.Since(t).Milliseconds()
+	return result, nil
+}
+
+// suggestPrefixes разбивает запрос на слова так же, как анализатор подсказок:
+// по небуквенным символам, в нижнем регистре, не длиннее индексируемого префикса
+func suggestPrefixes(queryText string) []string {
+	words := strings.FieldsFunc(strings.ToLower(queryText), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for i, w := range words {
+		if utf8.RuneCountInString(w) > index.SuggestMaxPrefix {
+			words[i] = string([]rune(w)[:index.SuggestMaxPrefix])
+		}
+	}
+	return words
+}
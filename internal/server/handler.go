@@ -12,8 +12,16 @@ import (
 	"path/filepath"
 	"searchengine/internal/common/request"
 	"searchengine/internal/config"
+	"searchengine/internal/eval"
+	"searchengine/internal/experiment"
+	"searchengine/internal/index"
+	"searchengine/internal/metrics"
+	"searchengine/internal/rank"
+	"searchengine/internal/rules"
+	"searchengine/internal/search"
 	"searchengine/internal/validate"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -21,6 +29,7 @@ import (
 var (
 	errNotFound         = errors.New("not found")
 	errMethodNotAllowed = errors.New("method not allowed")
+	errBadRequest       = errors.New("bad request")
 )
 
 func (s *Server) AddDocumentToIndex(method string, body []byte, args *fasthttp.Args) ([]byte, error) {
@@ -93,6 +102,22 @@ func (s *Server) getAllDoc(method string, args *fasthttp.Args) ([]byte, error) {
 		return nil, errMethodNotAllowed
 	}
 
+	// постраничный обход курсором; страницы больше, чем в поиске, чтобы обойти индекс за разумное число запросов
+	if args.Has("cursor") || args.Has("size") {
+		size, err := s.parseSize(args, s.Cfg.GetAllMaxSize, s.Cfg.GetAllMaxSize)
+		if err != nil {
+			return nil, err
+		}
+		hits, next, err := s.IndexCli.GetDocsPage(string(args.Peek("cursor")), size)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(map[string]interface{}{
+			"hits":        hits,
+			"next_cursor": next,
+		})
+	}
+
 	resp, err := s.IndexCli.GetAllDoc()
 	if err != nil {
 		return nil, err
@@ -176,43 +201,439 @@ func (s *Server) rebuildIndex(method string, args *fasthttp.Args) error {
 	return s.IndexCli.RebuildIndex()
 }
 
-func (s *Server) Search(method string, args *fasthttp.Args) ([]byte, error) {
+func (s *Server) Search(method string, args *fasthttp.Args, header *fasthttp.RequestHeader) ([]byte, error) {
 	if method != http.MethodGet {
 		return nil, errMethodNotAllowed
 	}
 
-	query := string(args.Peek("query"))
-	if query == "" {
+	req, err := s.parseSearchRequest(args)
+	if err != nil {
+		return nil, err
+	}
+	if req.Query == "" {
 		return nil, errors.New("query is empty")
 	}
 
-	var filters *request.FilterRequest
+	// параметры варианта эксперимента не перекрывают явно заданные в запросе
+	assignments := s.experimentCli.Assign(headerValue(header))
+	experiment.Apply(req, assignments, func(option string) bool { return args.Has(option) })
+
+	t := time.Now()
+	resp, err := s.SearchCli.AdvancedSearch(req)
+	experimentMetrics(SEARCH_PATH, assignments, t, resp, err)
+	if err != nil {
+		return nil, err
+	}
+	resp.Experiments = assignments
+
+	// режим совместимости: голый массив результатов без пагинации
+	if string(args.Peek("format")) == "array" {
+		return json.Marshal(&resp.Hits)
+	}
+
+	return json.Marshal(resp)
+}
+
+// Explain - объяснение score документа docId для запроса с параметрами как у /search
+func (s *Server) Explain(method string, args *fasthttp.Args) ([]byte, error) {
+	if method != http.MethodGet {
+		return nil, errMethodNotAllowed
+	}
+
+	docID := string(args.Peek("docId"))
+	if docID == "" {
+		return nil, fmt.Errorf("%w: docId is empty", errBadRequest)
+	}
+	doc, err := s.IndexCli.GetDocId(docID)
+	if err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return nil, errNotFound
+	}
+
+	req, err := s.parseSearchRequest(args)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.SearchCli.Explain(docID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(resp)
+}
+
+// Similar - документы, похожие на docId; параметры выдачи как у /search, sameCategory=true - только из той же категории
+func (s *Server) Similar(method string, args *fasthttp.Args) ([]byte, error) {
+	if method != http.MethodGet {
+		return nil, errMethodNotAllowed
+	}
+
+	docID := string(args.Peek("docId"))
+	if docID == "" {
+		return nil, fmt.Errorf("%w: docId is empty", errBadRequest)
+	}
+	doc, err := s.IndexCli.GetDocId(docID)
+	if err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return nil, errNotFound
+	}
+
+	req, err := s.parseSearchRequest(args)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.SearchCli.Similar(doc, args.GetBool("sameCategory"), req)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(resp)
+}
+
+// Suggest - автодополнение по префиксам слов suggest полей
+func (s *Server) Suggest(method string, args *fasthttp.Args) ([]byte, error) {
+	if method != http.MethodGet {
+		return nil, errMethodNotAllowed
+	}
+
+	req := &request.SuggestRequest{
+		Query: string(args.Peek("query")),
+	}
+
 	filtersData := args.Peek("filters")
 	if len(filtersData) != 0 {
-		err := json.Unmarshal(filtersData, &filters)
+		err := json.Unmarshal(filtersData, &req.Filters)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errBadRequest, err)
+		}
+	}
+
+	var err error
+	req.Size, err = s.parseSize(args, s.Cfg.SearchDefaultSize, s.Cfg.SearchMaxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.SearchCli.Suggest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(resp)
+}
+
+// parseSearchRequest разбирает параметры поиска из query string
+func (s *Server) parseSearchRequest(args *fasthttp.Args) (*request.SearchRequest, error) {
+	req := &request.SearchRequest{
+		Query: string(args.Peek("query")),
+	}
+
+	filtersData := args.Peek("filters")
+	if len(filtersData) != 0 {
+		err := json.Unmarshal(filtersData, &req.Filters)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	sortField := string(args.Peek("sortField"))
-	if sortField != "" {
-		if !validate.ValidateSortField(s.Cfg, sortField) {
+	req.SortField = string(args.Peek("sortField"))
+	if req.SortField != "" {
+		if !validate.ValidateSortField(s.Cfg, req.SortField) {
 			return nil, errors.New("invalid sort field")
 		}
 	}
-	sortOrder := string(args.Peek("sortOrder"))
+	req.SortOrder = string(args.Peek("sortOrder"))
+	req.Facets = args.GetBool("facets")
+	req.AutoCorrect = args.GetBool("autocorrect")
+	req.Intent = args.GetBool("intent")
+	req.Operator = string(args.Peek("operator"))
+	if req.Operator != "" && req.Operator != search.OperatorAnd && req.Operator != search.OperatorOr {
+		return nil, fmt.Errorf("%w: operator must be %s or %s", errBadRequest, search.OperatorAnd, search.OperatorOr)
+	}
+	req.MinimumShouldMatch = string(args.Peek("minimum_should_match"))
+	if req.MinimumShouldMatch != "" {
+		if req.Operator == search.OperatorAnd {
+			return nil, fmt.Errorf("%w: minimum_should_match can't be used with operator=%s", errBadRequest, search.OperatorAnd)
+		}
+		if _, err := search.MinimumShouldMatch(req.MinimumShouldMatch, 1); err != nil {
+			return nil, fmt.Errorf("%w: %v", errBadRequest, err)
+		}
+	}
+	req.RankProfile = string(args.Peek("rankProfile"))
+	req.Explain = args.GetBool("explain")
 
-	resp, err := s.SearchCli.AdvancedSearch(query, filters, sortField, sortOrder)
+	if args.Has("fuzziness") {
+		fuzziness, err := args.GetUint("fuzziness")
+		if err != nil || fuzziness > 2 {
+			return nil, fmt.Errorf("%w: fuzziness must be between 0 and 2", errBadRequest)
+		}
+		req.Fuzziness = &fuzziness
+	}
+
+	err := s.parsePagination(args, req)
 	if err != nil {
 		return nil, err
 	}
 
-	if resp == nil {
-		resp = make([]map[string]interface{}, 0)
+	req.Fields, err = s.parseFieldList(args, "fields")
+	if err != nil {
+		return nil, err
+	}
+	req.SearchFields, err = s.parseSearchFields(args)
+	if err != nil {
+		return nil, err
+	}
+	req.ExcludeFields, err = s.parseFieldList(args, "excludeFields")
+	if err != nil {
+		return nil, err
 	}
 
-	return json.Marshal(&resp)
+	req.Highlight, err = parseHighlight(args)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// parseSearchFields разбирает поля полнотекстового поиска с весами: searchFields=title^3,seller
+func (s *Server) parseSearchFields(args *fasthttp.Args) ([]request.FieldWeight, error) {
+	value := string(args.Peek("searchFields"))
+	if value == "" {
+		return nil, nil
+	}
+
+	var fields []request.FieldWeight
+	for _, item := range strings.Split(value, ",") {
+		name, weightStr, hasWeight := strings.Cut(strings.TrimSpace(item), "^")
+		if !validate.ValidateSearchField(s.Cfg, name) {
+			return nil, fmt.Errorf("%w: field in searchFields is not searchable: %s", errBadRequest, name)
+		}
+		weight := 1.0
+		if hasWeight {
+			w, err := strconv.ParseFloat(weightStr, 64)
+			if err != nil || w <= 0 {
+				return nil, fmt.Errorf("%w: invalid weight of field %s: %s", errBadRequest, name, weightStr)
+			}
+			weight = w
+		}
+		fields = append(fields, request.FieldWeight{Field: name, Weight: weight})
+	}
+	return fields, nil
+}
+
+// parseFieldList разбирает список полей через запятую и проверяет их по конфигу индекса
+func (s *Server) parseFieldList(args *fasthttp.Args, name string) ([]string, error) {
+	value := string(args.Peek(name))
+	if value == "" {
+		return nil, nil
+	}
+
+	fields := strings.Split(value, ",")
+	for i, field := range fields {
+		fields[i] = strings.TrimSpace(field)
+		if !validate.ValidateField(s.Cfg, fields[i]) {
+			return nil, fmt.Errorf("%w: unknown field in %s: %s", errBadRequest, name, fields[i])
+		}
+	}
+	return fields, nil
+}
+
+// parseHighlight разбирает параметры подсветки: highlight=html|ansi|true,
+// fragmentSize, fragments, preTag, postTag
+func parseHighlight(args *fasthttp.Args) (*request.HighlightRequest, error) {
+	style := string(args.Peek("highlight"))
+	if style == "" || style == "false" {
+		return nil, nil
+	}
+	if style == "true" {
+		style = search.HighlightHTML
+	}
+
+	hr := &request.HighlightRequest{
+		Style:   style,
+		PreTag:  string(args.Peek("preTag")),
+		PostTag: string(args.Peek("postTag")),
+	}
+	err := checkHighlight(hr)
+	if err != nil {
+		return nil, err
+	}
+
+	if args.Has("fragmentSize") {
+		hr.FragmentSize, err = args.GetUint("fragmentSize")
+		if err != nil || hr.FragmentSize == 0 {
+			return nil, fmt.Errorf("%w: fragmentSize must be a positive number", errBadRequest)
+		}
+	}
+	if args.Has("fragments") {
+		hr.Fragments, err = args.GetUint("fragments")
+		if err != nil || hr.Fragments == 0 {
+			return nil, fmt.Errorf("%w: fragments must be a positive number", errBadRequest)
+		}
+	}
+	return hr, nil
+}
+
+// checkHighlight проверяет стиль подсветки; у ansi сброс цвета добавляется сам, поэтому postTag не задается
+func checkHighlight(hr *request.HighlightRequest) error {
+	if hr.Style != "" && hr.Style != search.HighlightHTML && hr.Style != search.HighlightANSI {
+		return fmt.Errorf("%w: highlight must be html or ansi", errBadRequest)
+	}
+	if hr.Style == search.HighlightANSI && hr.PostTag != "" {
+		return fmt.Errorf("%w: postTag can't be used with ansi highlight", errBadRequest)
+	}
+	return nil
+}
+
+// parsePagination разбирает page/size, from/size или cursor/size
+func (s *Server) parsePagination(args *fasthttp.Args, req *request.SearchRequest) error {
+	var err error
+
+	req.Size, err = s.parseSize(args, s.Cfg.SearchDefaultSize, s.Cfg.SearchMaxSize)
+	if err != nil {
+		return err
+	}
+
+	req.Cursor = string(args.Peek("cursor"))
+	if req.Cursor != "" && (args.Has("page") || args.Has("from")) {
+		return fmt.Errorf("%w: cursor can't be combined with page or from", errBadRequest)
+	}
+
+	switch {
+	case args.Has("page"):
+		page, err := args.GetUint("page")
+		if err != nil || page == 0 {
+			return fmt.Errorf("%w: page must be a positive number", errBadRequest)
+		}
+		req.From = (page - 1) * req.Size
+	case args.Has("from"):
+		req.From, err = args.GetUint("from")
+		if err != nil {
+			return fmt.Errorf("%w: from must be a non-negative number", errBadRequest)
+		}
+	}
+
+	return nil
+}
+
+// parseSize разбирает размер страницы с учетом значения по умолчанию и максимума
+func (s *Server) parseSize(args *fasthttp.Args, defaultSize, maxSize int) (int, error) {
+	if !args.Has("size") {
+		return defaultSize, nil
+	}
+
+	size, err := args.GetUint("size")
+	if err != nil || size == 0 {
+		return 0, fmt.Errorf("%w: size must be a positive number", errBadRequest)
+	}
+	return checkSize(size, maxSize)
+}
+
+// checkSize проверяет размер страницы на максимум
+func checkSize(size, maxSize int) (int, error) {
+	if size > maxSize {
+		return 0, fmt.Errorf("%w: size must be <= %d", errBadRequest, maxSize)
+	}
+	return size, nil
+}
+
+// Query - поиск по запросу в JSON DSL
+func (s *Server) Query(method string, body []byte, header *fasthttp.RequestHeader) ([]byte, error) {
+	if method != http.MethodPost {
+		return nil, errMethodNotAllowed
+	}
+
+	var qr request.QueryRequest
+	err := json.Unmarshal(body, &qr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errBadRequest, err)
+	}
+	if len(qr.Query) == 0 {
+		return nil, fmt.Errorf("%w: query is empty", errBadRequest)
+	}
+
+	req := &request.SearchRequest{
+		Filters:       qr.Filters,
+		SortField:     qr.SortField,
+		SortOrder:     qr.SortOrder,
+		From:          qr.From,
+		Size:          qr.Size,
+		Cursor:        qr.Cursor,
+		Facets:        qr.Facets,
+		Highlight:     qr.Highlight,
+		Fields:        qr.Fields,
+		ExcludeFields: qr.ExcludeFields,
+		RankProfile:   qr.RankProfile,
+		Explain:       qr.Explain,
+	}
+	if req.SortField != "" && !validate.ValidateSortField(s.Cfg, req.SortField) {
+		return nil, fmt.Errorf("%w: invalid sort field", errBadRequest)
+	}
+	switch {
+	case req.Size < 0 || req.From < 0:
+		return nil, fmt.Errorf("%w: size and from must be non-negative", errBadRequest)
+	case req.Size == 0:
+		req.Size = s.Cfg.SearchDefaultSize
+	}
+	req.Size, err = checkSize(req.Size, s.Cfg.SearchMaxSize)
+	if err != nil {
+		return nil, err
+	}
+	if req.Cursor != "" && req.From != 0 {
+		return nil, fmt.Errorf("%w: cursor can't be combined with from", errBadRequest)
+	}
+	for _, field := range append(append([]string{}, req.Fields...), req.ExcludeFields...) {
+		if !validate.ValidateField(s.Cfg, field) {
+			return nil, fmt.Errorf("%w: unknown field: %s", errBadRequest, field)
+		}
+	}
+	if req.Highlight != nil {
+		err = checkHighlight(req.Highlight)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// в DSL нет исправления опечаток и fuzziness запроса, из варианта эксперимента применяется только профиль ранжирования
+	assignments := s.experimentCli.Assign(headerValue(header))
+	experiment.Apply(req, assignments, func(option string) bool {
+		return option != experiment.OptionRankProfile || qr.RankProfile != ""
+	})
+
+	t := time.Now()
+	resp, err := s.SearchCli.Query(qr.Query, req)
+	experimentMetrics(QUERY_PATH, assignments, t, resp, err)
+	if err != nil {
+		return nil, err
+	}
+	resp.Experiments = assignments
+
+	return json.Marshal(resp)
+}
+
+// headerValue - значение заголовка запроса по имени
+func headerValue(header *fasthttp.RequestHeader) func(name string) string {
+	return func(name string) string {
+		return string(header.Peek(name))
+	}
+}
+
+// experimentMetrics учитывает поиск в метриках назначенных запросу вариантов экспериментов
+func experimentMetrics(handler string, assignments []experiment.Assignment, start time.Time, resp *search.SearchResult, err error) {
+	for _, a := range assignments {
+		if err != nil {
+			metrics.ExperimentError(a.Experiment, a.Variant, handler)
+			continue
+		}
+		metrics.ExperimentSearch(a.Experiment, a.Variant, handler, time.Since(start).Seconds(), resp.Total == 0)
+	}
 }
 
 func (s *Server) FiltersByCategory(method string, args *fasthttp.Args) ([]byte, error) {
@@ -296,6 +717,19 @@ func (s *Server) getConfigRanking(method string, args *fasthttp.Args) ([]byte, e
 		return nil, errMethodNotAllowed
 	}
 
+	// profile - один профиль ранжирования, без него - весь конфиг со всеми профилями
+	profile := string(args.Peek("profile"))
+	if profile == rank.DefaultProfile {
+		return json.Marshal(s.Cfg.RankCfg.RankProfile)
+	}
+	if profile != "" {
+		p, ok := s.Cfg.RankCfg.Profiles[profile]
+		if !ok {
+			return nil, errNotFound
+		}
+		return json.Marshal(p)
+	}
+
 	data, err := os.ReadFile(fmt.Sprintf("%s%s", s.Cfg.CfgDirPath, s.Cfg.RankConfigPath))
 	if err != nil {
 		return nil, err
@@ -314,6 +748,16 @@ func (s *Server) updateConfigIndex(method string, body []byte, args *fasthttp.Ar
 		return err
 	}
 
+	err = indexCfgNew.Validate()
+	if err != nil {
+		return err
+	}
+	// проверяем, что из конфига собирается маппинг (цепочки анализаторов и т.п.)
+	_, err = index.BuildMapping(indexCfgNew)
+	if err != nil {
+		return err
+	}
+
 	if s.IndexCli.IsBuilded() {
 
 		tmpIndexPath := fmt.Sprintf("%s%s_old.json", s.Cfg.CfgDirPath, strings.TrimSuffix(s.Cfg.IndexConfigPath, ".json"))
@@ -348,6 +792,7 @@ func (s *Server) updateConfigIndex(method string, body []byte, args *fasthttp.Ar
 
 	s.IndexCli.SetNeedRebuild()
 	s.Cfg.IndexCfg = indexCfgNew
+	s.SearchCli.RankCli.SetIndexCfg(indexCfgNew)
 
 	return nil
 }
@@ -391,6 +836,7 @@ func (s *Server) revertIndexConfig(method string, args *fasthttp.Args) error {
 	_ = os.RemoveAll(fmt.Sprintf("%s%s_old.json", s.Cfg.CfgDirPath, strings.TrimSuffix(s.Cfg.IndexConfigPath, ".json")))
 
 	s.Cfg.IndexCfg = indexCfgOld
+	s.SearchCli.RankCli.SetIndexCfg(indexCfgOld)
 	s.IndexCli.SetBuilded()
 	return nil
 }
@@ -404,6 +850,11 @@ func (s *Server) updateConfigFilter(method string, body []byte, args *fasthttp.A
 	if err != nil {
 		return err
 	}
+	// фильтры, на которые ссылаются правила переписывания запроса, нельзя удалить
+	err = s.SearchCli.Rewriter.GetCfg().ValidateFilters(cfgNew)
+	if err != nil {
+		return fmt.Errorf("%w: rewrite rules: %v", errBadRequest, err)
+	}
 
 	err = s.filterCli.RebuildFilters(cfgNew)
 	if err != nil {
@@ -435,6 +886,16 @@ func (s *Server) updateConfigRanking(method string, body []byte, args *fasthttp.
 	if err != nil {
 		return err
 	}
+	// профили, на которые ссылаются эксперименты, нельзя удалить
+	err = s.experimentCli.CheckRankConfig(cfgNew)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errBadRequest, err)
+	}
+	// проверка и применение до записи: при ошибке остаются текущий конфиг и модель
+	err = s.SearchCli.RankCli.SetCfg(cfgNew)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errBadRequest, err)
+	}
 
 	// запись нового конфига
 	fNew, err := os.Create(fmt.Sprintf("%s%s", s.Cfg.CfgDirPath, s.Cfg.RankConfigPath))
@@ -447,12 +908,276 @@ func (s *Server) updateConfigRanking(method string, body []byte, args *fasthttp.
 	}
 	fNew.Close()
 
-	s.SearchCli.RankCli.SetCfg(cfgNew)
 	s.Cfg.RankCfg = cfgNew
 
 	return nil
 }
 
+func (s *Server) getConfigExperiments(method string, args *fasthttp.Args) ([]byte, error) {
+	if method != http.MethodGet {
+		return nil, errMethodNotAllowed
+	}
+
+	return json.Marshal(s.experimentCli.GetAll())
+}
+
+// updateConfigExperiments заменяет все эксперименты; назначение вариантов меняется сразу
+func (s *Server) updateConfigExperiments(method string, body []byte, args *fasthttp.Args) error {
+	if method != http.MethodPost {
+		return errMethodNotAllowed
+	}
+
+	cfgNew, err := config.LoadAnyConfigData[[]config.ExperimentConfig](body)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errBadRequest, err)
+	}
+	err = s.experimentCli.SetCfg(cfgNew, s.Cfg.RankCfg)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errBadRequest, err)
+	}
+
+	// запись нового конфига
+	fNew, err := os.Create(fmt.Sprintf("%s%s", s.Cfg.CfgDirPath, s.Cfg.ExperimentConfigPath))
+	if err != nil {
+		return err
+	}
+	_, err = fNew.Write(body)
+	if err != nil {
+		return err
+	}
+	fNew.Close()
+
+	s.Cfg.ExperimentCfg = cfgNew
+
+	return nil
+}
+
+func (s *Server) getConfigRewrite(method string, args *fasthttp.Args) ([]byte, error) {
+	if method != http.MethodGet {
+		return nil, errMethodNotAllowed
+	}
+
+	return json.Marshal(s.SearchCli.Rewriter.GetCfg())
+}
+
+// updateConfigRewrite заменяет правила переписывания запроса; применяются к следующим запросам
+func (s *Server) updateConfigRewrite(method string, body []byte, args *fasthttp.Args) error {
+	if method != http.MethodPost {
+		return errMethodNotAllowed
+	}
+
+	cfgNew, err := config.LoadAnyConfigData[*config.RewriteConfig](body)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errBadRequest, err)
+	}
+	err = s.SearchCli.Rewriter.SetCfg(cfgNew)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errBadRequest, err)
+	}
+
+	// запись нового конфига
+	fNew, err := os.Create(fmt.Sprintf("%s%s", s.Cfg.CfgDirPath, s.Cfg.RewriteConfigPath))
+	if err != nil {
+		return err
+	}
+	_, err = fNew.Write(body)
+	if err != nil {
+		return err
+	}
+	fNew.Close()
+
+	s.Cfg.RewriteCfg = cfgNew
+
+	return nil
+}
+
+// reloadConfigRewrite перечитывает правила переписывания запроса из файла, например после правки словаря стоп-слов
+func (s *Server) reloadConfigRewrite(method string, args *fasthttp.Args) error {
+	if method != http.MethodPost {
+		return errMethodNotAllowed
+	}
+
+	cfgNew, err := config.LoadRewriteConfig(fmt.Sprintf("%s%s", s.Cfg.CfgDirPath, s.Cfg.RewriteConfigPath))
+	if err != nil {
+		return fmt.Errorf("%w: %v", errBadRequest, err)
+	}
+	err = s.SearchCli.Rewriter.SetCfg(cfgNew)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errBadRequest, err)
+	}
+
+	s.Cfg.RewriteCfg = cfgNew
+
+	return nil
+}
+
+// synonyms - CRUD словаря синонимов: GET - список или правило по id, POST - добавить/заменить, DELETE - удалить
+func (s *Server) synonyms(method string, body []byte, args *fasthttp.Args) ([]byte, error) {
+	id := string(args.Peek("id"))
+
+	switch method {
+	case http.MethodGet:
+		if id == "" {
+			return json.Marshal(s.synonymCli.GetAll())
+		}
+		rule, ok := s.synonymCli.Get(id)
+		if !ok {
+			return nil, errNotFound
+		}
+		return json.Marshal(&rule)
+
+	case http.MethodPost:
+		var rule config.SynonymRule
+		err := json.Unmarshal(body, &rule)
+		if err != nil {
+			return nil, err
+		}
+		if rule.ID == "" {
+			rule.ID = uuid.NewString()
+		}
+		applied, err := s.synonymCli.Upsert(rule)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(map[string]interface{}{"id": rule.ID, "applied": applied})
+
+	case http.MethodDelete:
+		if id == "" {
+			return nil, errors.New("id is empty")
+		}
+		if _, ok := s.synonymCli.Get(id); !ok {
+			return nil, errNotFound
+		}
+		applied, err := s.synonymCli.Delete(id)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(map[string]interface{}{"id": id, "applied": applied})
+	}
+
+	return nil, errMethodNotAllowed
+}
+
+// rules - CRUD правил мерчандайзинга: GET - список или правило по id, POST - добавить/заменить, DELETE - удалить
+func (s *Server) rules(method string, body []byte, args *fasthttp.Args) ([]byte, error) {
+	id := string(args.Peek("id"))
+
+	switch method {
+	case http.MethodGet:
+		if id == "" {
+			return json.Marshal(s.rulesCli.GetAll())
+		}
+		rule, ok := s.rulesCli.Get(id)
+		if !ok {
+			return nil, errNotFound
+		}
+		return json.Marshal(&rule)
+
+	case http.MethodPost:
+		var rule rules.Rule
+		err := json.Unmarshal(body, &rule)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errBadRequest, err)
+		}
+		if rule.ID == "" {
+			rule.ID = uuid.NewString()
+		}
+		err = s.rulesCli.Upsert(rule)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errBadRequest, err)
+		}
+		return json.Marshal(map[string]interface{}{"id": rule.ID})
+
+	case http.MethodDelete:
+		if id == "" {
+			return nil, fmt.Errorf("%w: id is empty", errBadRequest)
+		}
+		if _, ok := s.rulesCli.Get(id); !ok {
+			return nil, errNotFound
+		}
+		err := s.rulesCli.Delete(id)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(map[string]interface{}{"id": id})
+	}
+
+	return nil, errMethodNotAllowed
+}
+
+// judgments - CRUD списков оценок: GET - все списки или список по id, POST - добавить/заменить, DELETE - удалить
+func (s *Server) judgments(method string, body []byte, args *fasthttp.Args) ([]byte, error) {
+	id := string(args.Peek("id"))
+
+	switch method {
+	case http.MethodGet:
+		if id == "" {
+			return json.Marshal(s.evalCli.GetAll())
+		}
+		list, ok := s.evalCli.Get(id)
+		if !ok {
+			return nil, errNotFound
+		}
+		return json.Marshal(&list)
+
+	case http.MethodPost:
+		var list eval.JudgmentList
+		err := json.Unmarshal(body, &list)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errBadRequest, err)
+		}
+		err = s.evalCli.Upsert(list)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errBadRequest, err)
+		}
+		return json.Marshal(map[string]interface{}{"id": list.ID})
+
+	case http.MethodDelete:
+		if id == "" {
+			return nil, fmt.Errorf("%w: id is empty", errBadRequest)
+		}
+		if _, ok := s.evalCli.Get(id); !ok {
+			return nil, errNotFound
+		}
+		err := s.evalCli.Delete(id)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(map[string]interface{}{"id": id})
+	}
+
+	return nil, errMethodNotAllowed
+}
+
+// evalRun - оценка текущего конфига ранжирования и конфига-кандидата по списку оценок
+func (s *Server) evalRun(method string, body []byte) ([]byte, error) {
+	if method != http.MethodPost {
+		return nil, errMethodNotAllowed
+	}
+
+	var req eval.RunRequest
+	err := json.Unmarshal(body, &req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errBadRequest, err)
+	}
+	if _, ok := s.evalCli.Get(req.List); !ok {
+		return nil, errNotFound
+	}
+	if req.K < 0 {
+		return nil, fmt.Errorf("%w: k must be a positive number", errBadRequest)
+	}
+	if _, err = checkSize(req.K, s.Cfg.SearchMaxSize); err != nil {
+		return nil, err
+	}
+
+	report, err := s.evalCli.Run(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(report)
+}
+
 func (s *Server) lastLogHandler(ctx *fasthttp.RequestCtx) ([]byte, error) {
 	files, err := s.getLogFiles()
 	if err != nil {
@@ -1,11 +1,14 @@
 package server
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/valyala/fasthttp"
 	"searchengine/internal/common/utils"
 	"searchengine/internal/metrics"
+	"searchengine/internal/search"
 	"strings"
 	"time"
 	"unicode/utf8"
@@ -28,15 +31,21 @@ const (
 	// SEARCH
 	SEARCH_SIMPLE_PATH = "/simpleSearch"
 	SEARCH_PATH        = "/search"
+	SUGGEST_PATH       = "/suggest"
+	QUERY_PATH         = "/query"
+	EXPLAIN_PATH       = "/explain"
+	SIMILAR_PATH       = "/similar"
 
 	// FILTERS
 	FILTERS_BY_CATEGORY      = "/filtersByCategory"
 	FILTERS_GET_ALL_CATEGORY = "/category"
 
 	// CONFIGS
-	GET_CONFIG_INDEX_PATH   = "/getConfig/index"
-	GET_CONFIG_FILTER_PATH  = "/getConfig/filter"
-	GET_CONFIG_RANKING_PATH = "/getConfig/ranking"
+	GET_CONFIG_INDEX_PATH       = "/getConfig/index"
+	GET_CONFIG_FILTER_PATH      = "/getConfig/filter"
+	GET_CONFIG_RANKING_PATH     = "/getConfig/ranking"
+	GET_CONFIG_EXPERIMENTS_PATH = "/getConfig/experiments"
+	GET_CONFIG_REWRITE_PATH     = "/getConfig/rewrite"
 
 	UPD_CONFIG_INDEX_PATH    = "/config/index"
 	REVERT_CONFIG_INDEX_PATH = "/config/index/revert"
@@ -45,6 +54,21 @@ const (
 	UPD_CONFIG_FILTER_PATH  = "/config/filter"
 	UPD_CONFIG_RANKING_PATH = "/config/ranking"
 
+	UPD_CONFIG_EXPERIMENTS_PATH = "/config/experiments"
+
+	UPD_CONFIG_REWRITE_PATH    = "/config/rewrite"
+	RELOAD_CONFIG_REWRITE_PATH = "/config/rewrite/reload"
+
+	// SYNONYMS
+	SYNONYMS_PATH = "/synonyms"
+
+	// MERCHANDISING
+	RULES_PATH = "/rules"
+
+	// EVALUATION
+	JUDGMENTS_PATH = "/eval/judgments"
+	EVAL_RUN_PATH  = "/eval/run"
+
 	// LOGS
 	LAST_LOG_PATH  = "/lastlog"
 	LIST_LOGS_PATH = "/listlogs"
@@ -98,9 +122,17 @@ func (s *Server) Handler(path string, ctx *fasthttp.RequestCtx) {
 
 	// SEARCH
 	case SEARCH_PATH:
-		resp, err = s.Search(method, ctx.QueryArgs())
+		resp, err = s.Search(method, ctx.QueryArgs(), &ctx.Request.Header)
 	case SEARCH_SIMPLE_PATH:
 		resp, err = s.SimpleSearch(method, ctx.QueryArgs())
+	case QUERY_PATH:
+		resp, err = s.Query(method, body, &ctx.Request.Header)
+	case SUGGEST_PATH:
+		resp, err = s.Suggest(method, ctx.QueryArgs())
+	case EXPLAIN_PATH:
+		resp, err = s.Explain(method, ctx.QueryArgs())
+	case SIMILAR_PATH:
+		resp, err = s.Similar(method, ctx.QueryArgs())
 
 	// FILTERS
 	case FILTERS_BY_CATEGORY:
@@ -127,6 +159,33 @@ func (s *Server) Handler(path string, ctx *fasthttp.RequestCtx) {
 		resp, err = s.getConfigRanking(method, ctx.QueryArgs())
 	case UPD_CONFIG_RANKING_PATH:
 		err = s.updateConfigRanking(method, body, ctx.QueryArgs())
+
+	case GET_CONFIG_EXPERIMENTS_PATH:
+		resp, err = s.getConfigExperiments(method, ctx.QueryArgs())
+	case UPD_CONFIG_EXPERIMENTS_PATH:
+		err = s.updateConfigExperiments(method, body, ctx.QueryArgs())
+
+	case GET_CONFIG_REWRITE_PATH:
+		resp, err = s.getConfigRewrite(method, ctx.QueryArgs())
+	case UPD_CONFIG_REWRITE_PATH:
+		err = s.updateConfigRewrite(method, body, ctx.QueryArgs())
+	case RELOAD_CONFIG_REWRITE_PATH:
+		err = s.reloadConfigRewrite(method, ctx.QueryArgs())
+
+	// SYNONYMS
+	case SYNONYMS_PATH:
+		resp, err = s.synonyms(method, body, ctx.QueryArgs())
+
+	// MERCHANDISING
+	case RULES_PATH:
+		resp, err = s.rules(method, body, ctx.QueryArgs())
+
+	// EVALUATION
+	case JUDGMENTS_PATH:
+		resp, err = s.judgments(method, body, ctx.QueryArgs())
+	case EVAL_RUN_PATH:
+		resp, err = s.evalRun(method, body)
+
 	case LAST_LOG_PATH:
 		_, err = s.lastLogHandler(ctx)
 	case LIST_LOGS_PATH:
@@ -142,7 +201,7 @@ func (s *Server) Handler(path string, ctx *fasthttp.RequestCtx) {
 
 	if err != nil {
 		metrics.ErrorRPS(path, method)
-		resp = []byte(err.Error())
+		resp = errorBody(err)
 	}
 	setStatusCode(ctx, err)
 	if resp != nil {
@@ -152,3 +211,19 @@ func (s *Server) Handler(path string, ctx *fasthttp.RequestCtx) {
 	metrics.RequestRPS(path, method, fmt.Sprintf("%d", ctx.Response.StatusCode()))
 	metrics.RequestDuration(path, method, time.Since(t).Seconds())
 }
+
+// errorBody - тело ответа с ошибкой. Ошибки разбора запроса отдаются структурой,
+// чтобы клиент мог показать место ошибки.
+func errorBody(err error) []byte {
+	var parseErr *search.ParseError
+	if errors.As(err, &parseErr) {
+		body, mErr := json.Marshal(struct {
+			Error string `json:"error"`
+			*search.ParseError
+		}{Error: search.ErrInvalidQuery.Error(), ParseError: parseErr})
+		if mErr == nil {
+			return body
+		}
+	}
+	return []byte(err.Error())
+}
@@ -2,15 +2,21 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/valyala/fasthttp"
 	"log"
 	"net/http"
 	"searchengine/internal/config"
+	"searchengine/internal/eval"
+	"searchengine/internal/experiment"
 	"searchengine/internal/filter"
 	"searchengine/internal/index"
+	"searchengine/internal/rank"
+	"searchengine/internal/rules"
 	"searchengine/internal/search"
+	"searchengine/internal/synonym"
 	"strings"
 )
 
@@ -21,22 +27,32 @@ type Server struct {
 	IndexCli   *index.Index
 	SearchCli  *search.SearchClient
 	filterCli  *filter.FilterClient
+	synonymCli *synonym.SynonymClient
+	rulesCli   *rules.RulesClient
+	evalCli    *eval.EvalClient
+
+	experimentCli *experiment.ExperimentClient
 }
 
 type ServerPrivate struct {
 	HttpServer *http.Server
 }
 
-func New(cfg *config.Config, indxCli *index.Index, searchCli *search.SearchClient, filterCli *filter.FilterClient) *Server {
+func New(cfg *config.Config, indxCli *index.Index, searchCli *search.SearchClient, filterCli *filter.FilterClient, synonymCli *synonym.SynonymClient, rulesCli *rules.RulesClient, evalCli *eval.EvalClient, experimentCli *experiment.ExperimentClient) *Server {
 	return &Server{
 		HttpServer: new(fasthttp.Server),
 		Debug: &http.Server{
 			Addr: cfg.PrivatePort,
 		},
-		Cfg:       cfg,
-		IndexCli:  indxCli,
-		SearchCli: searchCli,
-		filterCli: filterCli,
+		Cfg:        cfg,
+		IndexCli:   indxCli,
+		SearchCli:  searchCli,
+		filterCli:  filterCli,
+		synonymCli: synonymCli,
+		rulesCli:   rulesCli,
+		evalCli:    evalCli,
+
+		experimentCli: experimentCli,
 	}
 }
 
@@ -76,7 +92,10 @@ func setStatusCode(ctx *fasthttp.RequestCtx, err error) {
 			ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
 
 		default:
-			if strings.Contains(err.Error(), "Can't revert") {
+			if errors.Is(err, errBadRequest) || errors.Is(err, index.ErrInvalidCursor) ||
+				errors.Is(err, search.ErrInvalidQuery) || errors.Is(err, rank.ErrUnknownProfile) ||
+				errors.Is(err, eval.ErrInvalidRankConfig) ||
+				strings.Contains(err.Error(), "Can't revert") {
 				ctx.SetStatusCode(fasthttp.StatusBadRequest)
 			} else {
 				ctx.SetStatusCode(fasthttp.StatusInternalServerError)
@@ -0,0 +1,166 @@
+package spell
+
+import (
+	"fmt"
+	"searchengine/internal/config"
+	"searchengine/internal/index"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// SpellClient исправляет опечатки в запросе по словарю терминов индекса
+type SpellClient struct {
+	cfg *config.Config
+
+	indxCli *index.Index
+
+	mu *sync.Mutex
+
+	// dict - слово -> количество документов, builtAt - время построения словаря
+	dict    map[string]uint64
+	builtAt time.Time
+}
+
+func New(cfg *config.Config, indxCli *index.Index) *SpellClient {
+	return &SpellClient{
+		cfg:     cfg,
+		indxCli: indxCli,
+		mu:      new(sync.Mutex),
+	}
+}
+
+// Correct возвращает исправленный запрос. Слово заменяется ближайшим по расстоянию
+// Левенштейна словом словаря, при равном расстоянии - самым частым.
+// Второе значение false - исправлять нечего.
+func (sc *SpellClient) Correct(queryText string) (string, bool, error) {
+	dict, err := sc.dictionary()
+	if err != nil {
+		return "", false, err
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(queryText), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	changed := false
+	for i, w := range words {
+		if _, ok := dict[w]; ok {
+			continue
+		}
+		if c, ok := closest(dict, w); ok {
+			words[i] = c
+			changed = true
+		}
+	}
+	if !changed {
+		return "", false, nil
+	}
+	return strings.Join(words, " "), true, nil
+}
+
+// Known сообщает, что слово есть в словаре индекса
+func (sc *SpellClient) Known(word string) (bool, error) {
+	dict, err := sc.dictionary()
+	if err != nil {
+		return false, err
+	}
+	_, ok := dict[word]
+	return ok, nil
+}
+
+// Empty сообщает, что словарь пуст: индекс построен без поля словаря или в нем нет документов
+func (sc *SpellClient) Empty() (bool, error) {
+	dict, err := sc.dictionary()
+	if err != nil {
+		return false, err
+	}
+	return len(dict) == 0, nil
+}
+
+// dictionary возвращает словарь индекса, перестраивая его раз в SPELL_DICT_TTL
+func (sc *SpellClient) dictionary() (map[string]uint64, error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if sc.dict != nil && time.Since(sc.builtAt) < sc.cfg.SpellDictTTL {
+		return sc.dict, nil
+	}
+
+	dict, err := sc.indxCli.Dictionary(index.SpellField)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка построения словаря: %v", err)
+	}
+	sc.dict = dict
+	sc.builtAt = time.Now()
+	return dict, nil
+}
+
+// closest ищет в словаре слово на допустимом расстоянии от word
+func closest(dict map[string]uint64, word string) (string, bool) {
+	wr := []rune(word)
+	maxDist := maxEdits(len(wr))
+
+	best, bestDist, bestFreq := "", maxDist+1, uint64(0)
+	for term, freq := range dict {
+		tr := []rune(term)
+		if abs(len(tr)-len(wr)) > maxDist {
+			continue
+		}
+		d := levenshtein(wr, tr, bestDist)
+		if d > maxDist {
+			continue
+		}
+		if d < bestDist || (d == bestDist && (freq > bestFreq || (freq == bestFreq && term < best))) {
+			best, bestDist, bestFreq = term, d, freq
+		}
+	}
+	return best, best != ""
+}
+
+// maxEdits - допустимое число правок: в коротких словах одна, в длинных две
+func maxEdits(length int) int {
+	switch {
+	case length < 3:
+		return 0
+	case length <= 5:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// levenshtein считает расстояние редактирования; как только оно превышает limit, возвращает limit+1
+func levenshtein(a, b []rune, limit int) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			rowMin = min(rowMin, curr[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,74 @@
+package synonym
+
+import (
+	"fmt"
+	"searchengine/internal/common/store"
+	"searchengine/internal/config"
+	"searchengine/internal/index"
+	"sync"
+)
+
+// SynonymClient - словарь синонимов из SYNONYM_CONFIG_PATH; GetAll и Get - от хранилища,
+// Upsert и Delete дополнительно обновляют синонимы в индексе
+type SynonymClient struct {
+	*store.Store[config.SynonymRule]
+
+	cfg *config.Config
+
+	indxCli *index.Index
+
+	mu *sync.Mutex
+}
+
+func New(cfg *config.Config, indxCli *index.Index) *SynonymClient {
+	return &SynonymClient{
+		Store:   store.New(fmt.Sprintf("%s%s", cfg.CfgDirPath, cfg.SynonymConfigPath), cfg.SynonymCfg),
+		cfg:     cfg,
+		indxCli: indxCli,
+		mu:      new(sync.Mutex),
+	}
+}
+
+// Upsert добавляет или заменяет правило, сохраняет словарь и индексирует правило.
+// Возвращает false, если маппинг индекса не поддерживает синонимы и нужна пересборка индекса.
+func (sc *SynonymClient) Upsert(rule config.SynonymRule) (bool, error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	err := sc.Store.Upsert(rule)
+	if err != nil {
+		return false, err
+	}
+	// словарь из конфига индексируется при пересборке индекса
+	sc.cfg.SynonymCfg = sc.GetAll()
+
+	if !sc.indxCli.SupportsSynonyms() {
+		return false, nil
+	}
+	err = sc.indxCli.IndexSynonym(rule)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Delete удаляет правило из словаря и из индекса
+func (sc *SynonymClient) Delete(id string) (bool, error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	err := sc.Store.Delete(id)
+	if err != nil {
+		return false, err
+	}
+	sc.cfg.SynonymCfg = sc.GetAll()
+
+	if !sc.indxCli.SupportsSynonyms() {
+		return false, nil
+	}
+	err = sc.indxCli.DeleteSynonym(id)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -24,7 +24,7 @@ func ValidateDocument(config *config.IndexConfig, document map[string]interface{
 // validateFieldType проверяет соответствие типа значения ожидаемому
 func validateFieldType(expectedType string, value interface{}) bool {
 	switch expectedType {
-	case "string":
+	case "string", "keyword":
 		_, ok := value.(string)
 		return ok
 	case "timestamp":
@@ -49,3 +49,26 @@ func ValidateSortField(cfg *config.Config, sortField string) bool {
 	}
 	return false
 }
+
+// ValidateSearchField проверяет, что по полю идет полнотекстовый поиск
+func ValidateSearchField(cfg *config.Config, field string) bool {
+	for _, f := range cfg.IndexCfg.Fields {
+		if f.Name == field {
+			return f.Searchable && (f.Type == "string" || f.Type == "keyword")
+		}
+	}
+	return false
+}
+
+// ValidateField проверяет, что поле есть в конфиге индекса
+func ValidateField(cfg *config.Config, field string) bool {
+	if field == "category" {
+		return true
+	}
+	for _, f := range cfg.IndexCfg.Fields {
+		if f.Name == field {
+			return true
+		}
+	}
+	return false
+}
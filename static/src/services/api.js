@@ -39,7 +39,8 @@ export default {
                 query: params.query,
                 filters: JSON.stringify(params.filters),
                 sortField: params.sortField,
-                sortOrder: params.sortOrder
+                sortOrder: params.sortOrder,
+                format: 'array'
             }
         }),
     updateDoc: (docId, data) =>